@@ -2,61 +2,506 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"math/rand"
 	"sort"
 	"sync"
+	"time"
 
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
 	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
 	"nhooyr.io/websocket"
-	"nhooyr.io/websocket/wsjson"
 )
 
+const (
+	handshakeTimeout = 10 * time.Second
+
+	reconnectMinBackoff = 500 * time.Millisecond
+	reconnectMaxBackoff = 30 * time.Second
+	// reconnectAttempts is the number of failed attempts after which the client goes offline.
+	reconnectAttempts = 10
+	// offlineBufferSize is the number of messages buffered while reconnecting.
+	offlineBufferSize = 32
+)
+
+// ConnectionStatus is the state of the connection to the server.
+type ConnectionStatus int
+
+const (
+	StatusOnline ConnectionStatus = iota
+	StatusReconnecting
+	// StatusOffline is the state after the client gave up reconnecting.
+	StatusOffline
+)
+
+func (s ConnectionStatus) String() string {
+	switch s {
+	case StatusOnline:
+		return "ONLINE"
+	case StatusReconnecting:
+		return "RECONNECTING"
+	default:
+		return "OFFLINE"
+	}
+}
+
+// OfflinePolicy decides what happens to the messages sent while the client is reconnecting.
+type OfflinePolicy int
+
+const (
+	// OfflineBuffer keeps the last offlineBufferSize messages and sends them after reconnecting.
+	OfflineBuffer OfflinePolicy = iota
+	// OfflineDrop drops the messages.
+	OfflineDrop
+)
+
+var (
+	errOffline = errors.New("client is offline")
+	// errIncompatible is returned when the server speaks another protocol version.
+	errIncompatible = errors.New("incompatible protocol version")
+	// errConnectedElsewhere is returned when the player is already connected from another tab.
+	errConnectedElsewhere = errors.New("connected from another tab")
+)
+
+// GameClient is what the game needs from the server.
+// OfflineClient stands in for Client while the server is unreachable.
+type GameClient interface {
+	Room() (message.Room, bool)
+	// Name returns the name the player goes by in the room.
+	Name() string
+	Rooms() []message.Room
+	RoomError() string
+	RequestRooms(ctx context.Context) error
+	Join(ctx context.Context, code string) error
+	Create(ctx context.Context, name string, public bool) error
+	Status() ConnectionStatus
+	List() []*Gopher
+	Standing() []message.Result
+	RequestBoard(ctx context.Context, period string) error
+	Board(period string) []message.Result
+
+	sendMessage(ctx context.Context, msg *message.Message) error
+}
+
 type Client struct {
-	conn *websocket.Conn
+	host string
+	// hello is what the client says on every connection.
+	hello message.Hello
+
+	conn    *websocket.Conn
+	codec   message.Codec
+	token   string
+	status  ConnectionStatus
+	pending []*message.Message
+	// reconnectAfter is how long the server asked the client to wait before reconnecting.
+	reconnectAfter time.Duration
+	// connLock guards the fields above.
+	connLock sync.Mutex
+
+	id string
+	// name is the name the server gave the player in room.
+	name string
+
+	room     *message.Room
+	rooms    []message.Room
+	roomErr  string
+	roomLock sync.Mutex
 
 	members     map[string]*Gopher
 	membersLock sync.Mutex
 
 	standing     []message.Result
+	boards       map[string][]message.Result
 	standingLock sync.Mutex
 
 	gopherInitializer func() *Gopher
+
+	log *logger.Logger
+	// updates logs the frequent updates of the other players with sampling.
+	updates *logger.Logger
+	// updateLogSample is how many logs of updates one written log stands for.
+	updateLogSample int
+
+	// OfflinePolicy is applied to the messages sent while reconnecting.
+	OfflinePolicy OfflinePolicy
 }
 
-func NewClient(host string, gopherInitializer func() *Gopher) (*Client, error) {
-	conn, _, err := websocket.Dial(context.Background(), host, nil)
+var _ GameClient = &Client{}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to server: %w", err)
+// NewClient connects to host and says hello with the name, the room and the role in hello.
+// The identity kept in the storage is used unless hello has one.
+// Only one of every updateLogSample updates received is logged.
+// The client reconnects by itself if the connection is lost later.
+func NewClient(host string, hello message.Hello, updateLogSample int, gopherInitializer func() *Gopher) (*Client, error) {
+	if hello.Identity == "" {
+		hello.Identity = loadIdentity()
 	}
 
 	c := &Client{
-		conn:              conn,
+		host:              host,
+		hello:             hello,
 		members:           make(map[string]*Gopher),
+		boards:            make(map[string][]message.Result),
 		gopherInitializer: gopherInitializer,
+		log:               logger.With("server", host),
+		updateLogSample:   updateLogSample,
+
+		OfflinePolicy: OfflineBuffer,
 	}
+	c.updates = c.log.Sampled(updateLogSample)
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+
+	conn, codec, welcome, err := c.dial(ctx, "", hello.Room)
+	if err != nil {
+		return nil, err
+	}
+	c.online(ctx, conn, codec, welcome)
 
 	go c.recvHandler()
 
 	return c, nil
 }
 
+// dial connects to the server and says hello.
+// The player of token is resumed if it is not empty, and room is joined if it is not empty.
+func (c *Client) dial(ctx context.Context, token, room string) (*websocket.Conn, message.Codec, *message.Message, error) {
+	conn, _, err := websocket.Dial(ctx, c.host, &websocket.DialOptions{
+		Subprotocols: message.Subprotocols(),
+	})
+
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to connect to server: %w", err)
+	}
+	codec := message.CodecFor(conn.Subprotocol())
+
+	hello := c.hello
+	hello.Version = message.ProtocolVersion
+	hello.Build = build
+	hello.Room = room
+	hello.Capabilities = []string{
+		message.CapabilityRooms,
+		message.CapabilityBoards,
+		message.CapabilitySpectate,
+	}
+	hello.Token = token
+
+	err = writeMessage(ctx, conn, codec, &message.Message{
+		Kind:  message.KindHello,
+		Hello: &hello,
+	})
+	if err != nil {
+		conn.Close(websocket.StatusInternalError, "")
+
+		return nil, nil, nil, fmt.Errorf("failed to send hello: %w", err)
+	}
+
+	var welcome message.Message
+	if err := readMessage(ctx, conn, codec, &welcome); err != nil {
+		conn.Close(websocket.StatusInternalError, "")
+
+		var closeErr websocket.CloseError
+		if errors.As(err, &closeErr) {
+			switch closeErr.Code {
+			case message.CloseIncompatible:
+				return nil, nil, nil, fmt.Errorf("%w: %s", errIncompatible, closeErr.Reason)
+			case message.CloseConnectedElsewhere:
+				return nil, nil, nil, fmt.Errorf("%w: %s", errConnectedElsewhere, closeErr.Reason)
+			}
+
+			return nil, nil, nil, fmt.Errorf("server rejected the client: %s", closeErr.Reason)
+		}
+
+		return nil, nil, nil, fmt.Errorf("failed to receive welcome: %w", err)
+	}
+	if !welcome.Validate() || welcome.Kind != message.KindWelcome {
+		conn.Close(websocket.StatusProtocolError, "")
+
+		return nil, nil, nil, fmt.Errorf("unexpected message kind: %s", welcome.Kind)
+	}
+
+	return conn, codec, &welcome, nil
+}
+
+// online switches to a connection that has been welcomed and sends the buffered messages.
+func (c *Client) online(ctx context.Context, conn *websocket.Conn, codec message.Codec, welcome *message.Message) {
+	c.roomLock.Lock()
+	c.id = welcome.Welcome.PlayerID
+	c.name = welcome.Welcome.Name
+	c.room = welcome.Welcome.Room
+	c.roomErr = welcome.Error
+	c.roomLock.Unlock()
+
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	c.conn = conn
+	c.codec = codec
+	c.token = welcome.Welcome.Token
+	c.status = StatusOnline
+
+	c.log = logger.With("server", c.host, "player", welcome.Welcome.PlayerID)
+	c.updates = c.log.Sampled(c.updateLogSample)
+
+	if identity := welcome.Welcome.Identity; identity != "" && identity != c.hello.Identity {
+		c.hello.Identity = identity
+		saveIdentity(identity)
+	}
+
+	for _, msg := range c.pending {
+		if err := writeMessage(ctx, conn, codec, msg); err != nil {
+			c.log.Warn("failed to send buffered message", "err", err)
+
+			break
+		}
+	}
+	c.pending = nil
+}
+
+// reconnect dials the server again with exponential backoff and jitter.
+// It resumes the player and the room, and reports false if the client went offline.
+func (c *Client) reconnect() bool {
+	c.connLock.Lock()
+	c.status = StatusReconnecting
+	token := c.token
+	wait := c.reconnectAfter
+	c.reconnectAfter = 0
+	c.connLock.Unlock()
+
+	c.clearMembers()
+
+	var room string
+	if r, ok := c.Room(); ok {
+		room = r.Code
+	}
+
+	jitter := rand.New(rand.NewSource(time.Now().UnixNano()))
+	if wait > 0 {
+		// The clients of a server that shut down are spread over the next wait.
+		time.Sleep(wait + time.Duration(jitter.Int63n(int64(wait))))
+	}
+
+	backoff := reconnectMinBackoff
+	for attempt := 0; attempt < reconnectAttempts; attempt++ {
+		// Jitter keeps the clients that lost the server at once from coming back at once.
+		time.Sleep(backoff/2 + time.Duration(jitter.Int63n(int64(backoff/2)+1)))
+		if backoff *= 2; backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+		conn, codec, welcome, err := c.dial(ctx, token, room)
+		if err != nil {
+			cancel()
+			c.log.Warn("failed to reconnect", "attempt", attempt+1, "err", err)
+
+			if errors.Is(err, errIncompatible) || errors.Is(err, errConnectedElsewhere) {
+				break
+			}
+
+			continue
+		}
+
+		c.online(ctx, conn, codec, welcome)
+		cancel()
+		c.requestStandings()
+
+		return true
+	}
+
+	c.connLock.Lock()
+	c.status = StatusOffline
+	c.pending = nil
+	c.connLock.Unlock()
+
+	return false
+}
+
+// requestStandings requests the standing of the room and every board received before.
+func (c *Client) requestStandings() {
+	c.standingLock.Lock()
+	periods := make([]string, 0, len(c.boards)+1)
+	periods = append(periods, "")
+	for period := range c.boards {
+		periods = append(periods, period)
+	}
+	c.standingLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+
+	for _, period := range periods {
+		if err := c.RequestBoard(ctx, period); err != nil {
+			c.log.Warn("failed to request standing", "period", period, "err", err)
+		}
+	}
+}
+
+// Status returns the state of the connection.
+func (c *Client) Status() ConnectionStatus {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	return c.status
+}
+
+// Room returns the room the client is in and false if it is in none.
+func (c *Client) Room() (message.Room, bool) {
+	c.roomLock.Lock()
+	defer c.roomLock.Unlock()
+
+	if c.room == nil {
+		return message.Room{}, false
+	}
+
+	return *c.room, true
+}
+
+// Name returns the name the server gave the player in the room, or the name it said hello with.
+func (c *Client) Name() string {
+	c.roomLock.Lock()
+	defer c.roomLock.Unlock()
+
+	if c.name == "" {
+		return c.hello.Name
+	}
+
+	return c.name
+}
+
+// Rooms returns the public rooms last received by RequestRooms.
+func (c *Client) Rooms() []message.Room {
+	c.roomLock.Lock()
+	defer c.roomLock.Unlock()
+
+	res := make([]message.Room, len(c.rooms))
+	copy(res, c.rooms)
+
+	return res
+}
+
+// RoomError returns the reason the last join or create request failed.
+func (c *Client) RoomError() string {
+	c.roomLock.Lock()
+	defer c.roomLock.Unlock()
+
+	return c.roomErr
+}
+
+func (c *Client) RequestRooms(ctx context.Context) error {
+	return c.sendMessage(ctx, &message.Message{
+		Kind: message.KindRooms,
+	})
+}
+
+func (c *Client) Join(ctx context.Context, code string) error {
+	c.roomLock.Lock()
+	c.roomErr = ""
+	c.roomLock.Unlock()
+
+	return c.sendMessage(ctx, &message.Message{
+		Kind: message.KindJoin,
+		Room: &message.Room{
+			Code: code,
+		},
+	})
+}
+
+func (c *Client) Create(ctx context.Context, name string, public bool) error {
+	c.roomLock.Lock()
+	c.roomErr = ""
+	c.roomLock.Unlock()
+
+	return c.sendMessage(ctx, &message.Message{
+		Kind: message.KindCreate,
+		Room: &message.Room{
+			Name:   name,
+			Public: public,
+		},
+	})
+}
+
+// sendMessage sends msg, or handles it by OfflinePolicy if the client is not online.
 func (c *Client) sendMessage(ctx context.Context, msg *message.Message) error {
-	return wsjson.Write(ctx, c.conn, msg)
+	c.connLock.Lock()
+	if c.status != StatusOnline {
+		defer c.connLock.Unlock()
+
+		if c.status == StatusOffline || c.OfflinePolicy == OfflineDrop {
+			return errOffline
+		}
+
+		if len(c.pending) >= offlineBufferSize {
+			c.pending = c.pending[1:]
+		}
+		c.pending = append(c.pending, msg)
+
+		return nil
+	}
+	conn, codec := c.conn, c.codec
+	c.connLock.Unlock()
+
+	return writeMessage(ctx, conn, codec, msg)
 }
 
+func writeMessage(ctx context.Context, conn *websocket.Conn, codec message.Codec, msg *message.Message) error {
+	b, err := codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	typ := websocket.MessageText
+	if codec.Binary() {
+		typ = websocket.MessageBinary
+	}
+
+	return conn.Write(ctx, typ, b)
+}
+
+func readMessage(ctx context.Context, conn *websocket.Conn, codec message.Codec, msg *message.Message) error {
+	_, b, err := conn.Read(ctx)
+	if err != nil {
+		return err
+	}
+
+	return codec.Unmarshal(b, msg)
+}
+
+// recvHandler handles the messages from the server and reconnects when the connection is lost.
 func (c *Client) recvHandler() {
+	for {
+		c.connLock.Lock()
+		conn, codec := c.conn, c.codec
+		c.connLock.Unlock()
+
+		err := c.receive(conn, codec)
+		c.log.Warn("connection lost", "err", err)
+		conn.Close(websocket.StatusGoingAway, "")
+
+		if !c.reconnect() {
+			return
+		}
+	}
+}
+
+func (c *Client) receive(conn *websocket.Conn, codec message.Codec) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	var msg message.Message
 	for {
-		if err := wsjson.Read(ctx, c.conn, &msg); err != nil {
-			return
+		var msg message.Message
+		if err := readMessage(ctx, conn, codec, &msg); err != nil {
+			return err
+		}
+
+		if msg.Kind == message.KindUpdate {
+			c.updates.Debug("received", "kind", msg.Kind, "player", msg.User.ID)
+		} else {
+			c.log.Debug("received", "kind", msg.Kind)
 		}
 
-		log.Println("recv", msg)
 		switch msg.Kind {
 		case message.KindLeave:
 			c.membersLock.Lock()
@@ -82,17 +527,54 @@ func (c *Client) recvHandler() {
 
 			user.UpdateByMessage(&msg.User)
 
+		case message.KindJoin:
+			c.roomLock.Lock()
+			c.room = msg.Room
+			c.name = msg.User.Name
+			c.roomErr = ""
+			c.roomLock.Unlock()
+
+			c.clearMembers()
+
+		case message.KindRooms:
+			c.roomLock.Lock()
+			c.rooms = msg.Rooms
+			c.roomLock.Unlock()
+
+		case message.KindShutdown:
+			c.connLock.Lock()
+			c.reconnectAfter = msg.Shutdown.ReconnectAfter
+			c.connLock.Unlock()
+
+		case message.KindError:
+			c.roomLock.Lock()
+			c.roomErr = msg.Error
+			c.roomLock.Unlock()
+
 		case message.KindStanding:
 			c.standingLock.Lock()
 
-			if len(c.standing) != len(msg.Standing) {
-				c.standing = make([]message.Result, len(msg.Standing))
+			if msg.Period != "" {
+				c.boards[msg.Period] = msg.Standing
+			} else {
+				if len(c.standing) != len(msg.Standing) {
+					c.standing = make([]message.Result, len(msg.Standing))
+				}
+				copy(c.standing, msg.Standing)
 			}
-			copy(c.standing, msg.Standing)
 
 			c.standingLock.Unlock()
 		}
-		log.Println("after", msg)
+	}
+}
+
+func (c *Client) clearMembers() {
+	c.membersLock.Lock()
+	defer c.membersLock.Unlock()
+
+	for id, user := range c.members {
+		delete(c.members, id)
+		go user.Close()
 	}
 }
 
@@ -122,3 +604,21 @@ func (c *Client) Standing() []message.Result {
 
 	return res
 }
+
+func (c *Client) RequestBoard(ctx context.Context, period string) error {
+	return c.sendMessage(ctx, &message.Message{
+		Kind:   message.KindStanding,
+		Period: period,
+	})
+}
+
+// Board returns the leaderboard of period last received by RequestBoard.
+func (c *Client) Board(period string) []message.Result {
+	c.standingLock.Lock()
+	defer c.standingLock.Unlock()
+
+	res := make([]message.Result, len(c.boards[period]))
+	copy(res, c.boards[period])
+
+	return res
+}
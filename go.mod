@@ -8,5 +8,6 @@ require (
 	github.com/grafov/bcast v0.0.0-20190217190352-1447f067e08d
 	github.com/hajimehoshi/ebiten/v2 v2.0.1
 	golang.org/x/image v0.0.0-20200927104501-e162460cd6b5
+	gopkg.in/yaml.v2 v2.4.0
 	nhooyr.io/websocket v1.8.6
 )
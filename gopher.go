@@ -3,26 +3,42 @@ package main
 import (
 	"image/color"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/sim"
 	textsoba "github.com/cs3238-tsuzu/prasoba/text"
 	"github.com/hajimehoshi/ebiten/v2"
 )
 
+const (
+	// snapshotCapacity is the number of received states kept for a remote gopher.
+	snapshotCapacity = 16
+	// defaultInterpolationDelay is how far behind the remote gophers are rendered.
+	// It hides the jitter of updates at the cost of showing other players a bit late.
+	defaultInterpolationDelay = 100 * time.Millisecond
+)
+
+// snapshot is a state of a remote gopher and the time it was received.
+type snapshot struct {
+	body sim.Body
+	at   time.Time
+}
+
 type Gopher struct {
-	// The gopher's position
-	x16     int
-	y16     int
-	vy16    int
-	running bool
+	body sim.Body
+
+	// snapshots are the received states of a remote gopher in the order of ticks.
+	// from is the tick of the snapshot that body was stepped from.
+	snapshots []snapshot
+	from      int
 
 	gopherImage *ebiten.Image
 
-	volume    float64
-	id, name  string
-	updatedAt time.Time
+	volume   float64
+	id, name string
 
 	lock sync.RWMutex
 
@@ -37,23 +53,15 @@ type Gopher struct {
 func NewGopher(gopherImage *ebiten.Image, jumpPlayerPool, hitPlayerPool *AudioPool) *Gopher {
 	g := &Gopher{}
 
-	g.x16 = 0
-	g.y16 = 100 * 16
+	g.body = sim.NewBody()
 	g.gopherImage = gopherImage
 	g.jumpPlayerPool = jumpPlayerPool
 	g.hitPlayerPool = hitPlayerPool
 	g.volume = math.NaN()
-	g.running = true
 
 	return g
 }
 
-func (g *Gopher) reset() {
-	g.x16 = 0
-	g.y16 = 100 * 16
-	g.running = true
-}
-
 func (g *Gopher) releasePlayer(force bool) {
 	g.playerLock.Lock()
 	defer g.playerLock.Unlock()
@@ -108,117 +116,107 @@ func (g *Gopher) playHitSound() {
 	g.play(player)
 }
 
-type PipeAtFn func(tileX int) (tileY int, ok bool)
+// Sync replaces the rendered state with the state of the simulation
+// and plays the sounds of the events in the last step.
+func (g *Gopher) Sync(body sim.Body, jumped, hit bool) {
+	g.releasePlayer(false)
 
-func (g *Gopher) hit(pipeAtFn PipeAtFn) bool {
-	if pipeAtFn == nil {
-		return false
-	}
+	g.lock.Lock()
+	g.body = body
+	g.lock.Unlock()
 
-	// if g.mode != ModeGame {
-	// 	return false
-	// }
-	const (
-		gopherWidth  = 30
-		gopherHeight = 60
-	)
-	w, h := gopherImage.Size()
-	x0 := floorDiv(g.x16, 16) + (w-gopherWidth)/2
-	y0 := floorDiv(g.y16, 16) + (h-gopherHeight)/2
-	x1 := x0 + gopherWidth
-	y1 := y0 + gopherHeight
-	if y0 < -tileSize*4 {
-		return true
+	if jumped {
+		g.playJumpSound()
 	}
-	if y1 >= screenHeight-tileSize {
-		return true
+	if hit {
+		g.playHitSound()
 	}
-	xMin := floorDiv(x0-pipeWidth, tileSize)
-	xMax := floorDiv(x0+gopherWidth, tileSize)
-	for x := xMin; x <= xMax; x++ {
-		y, ok := pipeAtFn(x)
-		if !ok {
-			continue
-		}
-		if x0 >= x*tileSize+pipeWidth {
-			continue
-		}
-		if x1 < x*tileSize {
-			continue
-		}
-		if y0 < y*tileSize {
-			return true
-		}
-		if y1 >= (y+pipeGapY)*tileSize {
-			return true
-		}
-	}
-	return false
 }
 
-func (g *Gopher) Update(jump bool, pipeAtFn PipeAtFn) bool {
-	g.releasePlayer(false)
-
+// Interpolate moves a remote gopher to where it was delay ago.
+// The remote tick at that time is estimated from the latest snapshot. The gopher is stepped
+// without input from the last snapshot before that tick, so it follows the path between two snapshots
+// and keeps flying past the latest one until it hits something in pipeAtFn.
+func (g *Gopher) Interpolate(now time.Time, delay time.Duration, pipeAtFn sim.PipeAtFn) {
 	g.lock.Lock()
+	defer g.lock.Unlock()
 
-	if g.running {
-		g.x16 += 32
-		if jump {
-			g.vy16 = -96
-
-			g.playJumpSound()
-		}
-		g.y16 += g.vy16
-
-		// Gravity
-		g.vy16 += 4
-		if g.vy16 > 96 {
-			g.vy16 = 96
-		}
-
-		hit := g.hit(pipeAtFn)
-
-		if hit {
-			g.running = false
-			g.lock.Unlock()
+	if len(g.snapshots) == 0 {
+		return
+	}
 
-			g.playHitSound()
+	latest := g.snapshots[len(g.snapshots)-1]
+	tick := latest.body.Tick + int((now.Sub(latest.at)-delay)*sim.TPS/time.Second)
 
-			return true
-		}
+	idx := sort.Search(len(g.snapshots), func(i int) bool {
+		return g.snapshots[i].body.Tick > tick
+	}) - 1
+	if idx < 0 {
+		idx = 0
 	}
+	from := g.snapshots[idx].body
 
-	g.lock.Unlock()
+	// Older snapshots are no longer needed.
+	g.snapshots = g.snapshots[idx:]
 
-	return false
+	// The gopher waits instead of going back when a new snapshot delays the estimate.
+	if g.from != from.Tick || g.body.Tick < from.Tick {
+		g.body = from
+		g.from = from.Tick
+	}
+	for g.body.Running && g.body.Tick < tick {
+		g.body.Step(false, pipeAtFn)
+	}
 }
 
+// UpdateByMessage buffers a state of a remote gopher received from the server.
 func (g *Gopher) UpdateByMessage(msg *message.User) {
 	g.lock.Lock()
 	defer g.lock.Unlock()
 
-	g.x16 = msg.X16
-	g.y16 = msg.Y16
-	g.vy16 = msg.VY16
+	now := time.Now()
+	body := sim.Body{
+		X16:     msg.X16,
+		Y16:     msg.Y16,
+		VY16:    msg.VY16,
+		Running: msg.Running,
+		Tick:    msg.Tick,
+	}
+
+	// A restarted run begins at an earlier tick.
+	if n := len(g.snapshots); n != 0 && g.snapshots[n-1].body.Tick > body.Tick {
+		g.snapshots = g.snapshots[:0]
+	}
+	if len(g.snapshots) >= snapshotCapacity {
+		g.snapshots = append(g.snapshots[:0], g.snapshots[1:]...)
+	}
+	g.snapshots = append(g.snapshots, snapshot{
+		body: body,
+		at:   now,
+	})
+
+	if len(g.snapshots) == 1 {
+		g.body = body
+		g.from = body.Tick
+	}
 	g.id = msg.ID
 	g.name = msg.Name
-	g.running = msg.Running
-	g.updatedAt = time.Now()
 }
 
-func (g *Gopher) ComposeMessage() (msg *message.Message) {
+func (g *Gopher) ComposeMessage(kind string) (msg *message.Message) {
 	g.lock.RLock()
 	defer g.lock.RUnlock()
 
 	return &message.Message{
-		Kind: message.KindUpdate,
+		Kind: kind,
 		User: message.User{
 			Name:    g.name,
-			X16:     g.x16,
-			Y16:     g.y16,
-			VY16:    g.vy16,
-			Running: g.running,
-			Score:   g.score(),
+			X16:     g.body.X16,
+			Y16:     g.body.Y16,
+			VY16:    g.body.VY16,
+			Running: g.body.Running,
+			Score:   g.body.Score(),
+			Tick:    g.body.Tick,
 		},
 	}
 }
@@ -227,20 +225,20 @@ func (g *Gopher) Pos() (int, int) {
 	g.lock.RLock()
 	defer g.lock.RUnlock()
 
-	return g.x16, g.y16
+	return g.body.X16, g.body.Y16
 }
 
 func (g *Gopher) Draw(screen *ebiten.Image, cameraX, cameraY int) {
 	g.lock.RLock()
 	defer g.lock.RUnlock()
 
-	x := float64(g.x16/16.0) - float64(cameraX)
-	y := float64(g.y16/16.0) - float64(cameraY)
+	x := float64(g.body.X16/16.0) - float64(cameraX)
+	y := float64(g.body.Y16/16.0) - float64(cameraY)
 
 	op := &ebiten.DrawImageOptions{}
 	w, h := g.gopherImage.Size()
 	op.GeoM.Translate(-float64(w)/2.0, -float64(h)/2.0)
-	op.GeoM.Rotate(float64(g.vy16) / 96.0 * math.Pi / 6)
+	op.GeoM.Rotate(float64(g.body.VY16) / 96.0 * math.Pi / 6)
 	op.GeoM.Translate(float64(w)/2.0, float64(h)/2.0)
 	op.GeoM.Translate(x, y)
 	op.Filter = ebiten.FilterLinear
@@ -253,19 +251,32 @@ func (g *Gopher) Draw(screen *ebiten.Image, cameraX, cameraY int) {
 
 }
 
-func (g *Gopher) score() int {
-	x := floorDiv(g.x16, 16) / tileSize
-	if (x - pipeStartOffsetX) <= 0 {
-		return 0
-	}
-	return floorDiv(x-pipeStartOffsetX, pipeIntervalX)
+func (g *Gopher) SetName(name string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.name = name
+}
+
+func (g *Gopher) Name() string {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	return g.name
+}
+
+func (g *Gopher) Running() bool {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	return g.body.Running
 }
 
 func (g *Gopher) Score() int {
 	g.lock.RLock()
 	defer g.lock.RUnlock()
 
-	return g.score()
+	return g.body.Score()
 }
 
 func (g *Gopher) Close() error {
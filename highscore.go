@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+)
+
+const (
+	highScoresKey = "highscores.json"
+	// highScoreCapacity is the number of runs kept in the local high-score table.
+	highScoreCapacity = 10
+)
+
+// HighScore is a run in the local high-score table.
+type HighScore struct {
+	Name string
+	Run  message.Run
+	// Uploaded is set once the run has been sent to the server.
+	Uploaded bool
+}
+
+// HighScores is the local high-score table of the runs played offline.
+type HighScores struct {
+	lock   sync.Mutex
+	scores []HighScore
+}
+
+// LoadHighScores loads the table from the local storage.
+// The table starts empty if it cannot be loaded.
+func LoadHighScores() *HighScores {
+	h := &HighScores{}
+
+	b, err := loadStorage(highScoresKey)
+	if err != nil {
+		logger.Warn("failed to load high scores", "err", err)
+
+		return h
+	}
+	if len(b) == 0 {
+		return h
+	}
+
+	if err := json.Unmarshal(b, &h.scores); err != nil {
+		logger.Warn("failed to parse high scores", "err", err)
+		h.scores = nil
+	}
+
+	return h
+}
+
+// Add adds a run to the table. It is dropped if it does not make the table.
+func (h *HighScores) Add(name string, run message.Run) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	// Earlier runs win ties.
+	idx := sort.Search(len(h.scores), func(i int) bool {
+		return h.scores[i].Run.Score < run.Score
+	})
+	if idx >= highScoreCapacity {
+		return
+	}
+
+	h.scores = append(h.scores, HighScore{})
+	copy(h.scores[idx+1:], h.scores[idx:])
+	h.scores[idx] = HighScore{
+		Name: name,
+		Run:  run,
+	}
+	if len(h.scores) > highScoreCapacity {
+		h.scores = h.scores[:highScoreCapacity]
+	}
+
+	h.save()
+}
+
+// Top returns at most limit best runs finished at or after since.
+func (h *HighScores) Top(since time.Time, limit int) []message.Result {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	res := make([]message.Result, 0, limit)
+	for _, s := range h.scores {
+		if len(res) >= limit {
+			break
+		}
+		if s.Run.At.Before(since) {
+			continue
+		}
+
+		res = append(res, message.Result{
+			Name:  s.Name,
+			Score: s.Run.Score,
+		})
+	}
+
+	return res
+}
+
+// Pending returns the runs that have not been uploaded yet.
+func (h *HighScores) Pending() []message.Run {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var runs []message.Run
+	for _, s := range h.scores {
+		if !s.Uploaded {
+			runs = append(runs, s.Run)
+		}
+	}
+
+	return runs
+}
+
+// MarkUploaded records that run has been sent to the server.
+func (h *HighScores) MarkUploaded(run message.Run) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i := range h.scores {
+		if h.scores[i].Run.Seed == run.Seed && h.scores[i].Run.At.Equal(run.At) {
+			h.scores[i].Uploaded = true
+		}
+	}
+
+	h.save()
+}
+
+func (h *HighScores) save() {
+	b, err := json.Marshal(h.scores)
+	if err != nil {
+		logger.Error("failed to encode high scores", "err", err)
+
+		return
+	}
+
+	if err := saveStorage(highScoresKey, b); err != nil {
+		logger.Warn("failed to save high scores", "err", err)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
+
+// identityKey is the storage key of the identity token the server issued.
+// It keeps the player ID of the player across visits.
+const identityKey = "identity"
+
+// loadIdentity returns the identity token in the storage, or an empty string if there is none.
+func loadIdentity() string {
+	b, err := loadStorage(identityKey)
+	if err != nil {
+		logger.Warn("failed to load identity", "err", err)
+	}
+
+	return string(b)
+}
+
+func saveIdentity(token string) {
+	if err := saveStorage(identityKey, []byte(token)); err != nil {
+		logger.Warn("failed to save identity", "err", err)
+	}
+}
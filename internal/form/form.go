@@ -162,11 +162,19 @@ func init() {
 }
 
 type Form struct {
+	// Label is shown above the text.
+	Label string
+	// Suffix is appended to the submitted text.
+	Suffix string
+	// AllowEmpty allows submitting an empty text.
+	AllowEmpty bool
+
 	caps bool
 	form string
 }
 
-func (f *Form) Update() string {
+// Update handles the input and returns the text and true when it is submitted.
+func (f *Form) Update() (string, bool) {
 	if capsFrame.Clicked() {
 		f.caps = !f.caps
 	}
@@ -195,14 +203,14 @@ func (f *Form) Update() string {
 		}
 	}
 
-	if len(f.form) != 0 && (okText.Clicked() || ebiten.IsKeyPressed(ebiten.KeyEnter)) {
-		name := f.form + " Gopher"
+	if (len(f.form) != 0 || f.AllowEmpty) && (okText.Clicked() || inpututil.IsKeyJustPressed(ebiten.KeyEnter)) {
+		value := f.form + f.Suffix
 		f.form = ""
 
-		return name
+		return value, true
 	}
 
-	return ""
+	return "", false
 }
 
 func (f *Form) drawBox(screen *ebiten.Image, frame *transformer.Rect, text *textsoba.Text, flag bool) {
@@ -219,7 +227,14 @@ func (f *Form) drawBox(screen *ebiten.Image, frame *transformer.Rect, text *text
 }
 
 func (f *Form) Draw(screen *ebiten.Image) {
-	textsoba.NewText(f.form+" Gopher", arcadeFont).
+	if f.Label != "" {
+		textsoba.NewText(f.Label, smallArcadeFont).
+			WithColor(color.White).
+			Center(screenWidth/2, 50).
+			Draw(screen)
+	}
+
+	textsoba.NewText(f.form+f.Suffix, arcadeFont).
 		WithColor(color.White).
 		Center(screenWidth/2, 100).
 		Draw(screen)
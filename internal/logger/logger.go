@@ -0,0 +1,246 @@
+// Package logger writes leveled logs of a message and key/value pairs.
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// ParseLevel parses debug, info, warn or error in any case.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level: %s", s)
+	}
+}
+
+// Formats of the records
+const (
+	// FormatText writes time=... level=... msg=... key=value on each line.
+	FormatText = "text"
+	// FormatJSON writes a JSON object on each line.
+	FormatJSON = "json"
+)
+
+// output is where every logger derived from New writes to.
+type output struct {
+	w     io.Writer
+	level Level
+	json  bool
+	lock  sync.Mutex
+}
+
+// Logger writes records with the fields given to With.
+type Logger struct {
+	out    *output
+	fields []interface{}
+	// sampler drops the records of a sampled logger between the ones it writes.
+	sampler *sampler
+}
+
+type sampler struct {
+	every uint64
+	count uint64
+}
+
+// New returns a logger writing the records of level and above to w in format.
+// Unknown formats are written as text.
+func New(w io.Writer, level Level, format string) *Logger {
+	return &Logger{
+		out: &output{
+			w:     w,
+			level: level,
+			json:  format == FormatJSON,
+		},
+	}
+}
+
+var (
+	std     = New(os.Stderr, LevelInfo, FormatText)
+	stdLock sync.Mutex
+)
+
+// Default returns the logger used by the functions of the package.
+func Default() *Logger {
+	stdLock.Lock()
+	defer stdLock.Unlock()
+
+	return std
+}
+
+// SetDefault replaces the logger used by the functions of the package.
+func SetDefault(l *Logger) {
+	stdLock.Lock()
+	defer stdLock.Unlock()
+
+	std = l
+}
+
+// With returns a logger adding the key/value pairs in kv to every record.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+
+	return &Logger{
+		out:     l.out,
+		fields:  fields,
+		sampler: l.sampler,
+	}
+}
+
+// Sampled returns a logger writing only the first of every n records, for frequent events.
+// The records tell how many they stand for in the sampled field.
+func (l *Logger) Sampled(n int) *Logger {
+	if n <= 1 {
+		return l
+	}
+
+	return &Logger{
+		out:     l.out,
+		fields:  l.fields,
+		sampler: &sampler{every: uint64(n)},
+	}
+}
+
+// Enabled reports whether records of level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.log(LevelInfo, msg, kv) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.log(LevelWarn, msg, kv) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+func Debug(msg string, kv ...interface{}) { Default().log(LevelDebug, msg, kv) }
+func Info(msg string, kv ...interface{})  { Default().log(LevelInfo, msg, kv) }
+func Warn(msg string, kv ...interface{})  { Default().log(LevelWarn, msg, kv) }
+func Error(msg string, kv ...interface{}) { Default().log(LevelError, msg, kv) }
+
+// With returns the default logger with the key/value pairs in kv.
+func With(kv ...interface{}) *Logger {
+	return Default().With(kv...)
+}
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	if l.sampler != nil {
+		if atomic.AddUint64(&l.sampler.count, 1)%l.sampler.every != 1 {
+			return
+		}
+		kv = append(kv[:len(kv):len(kv)], "sampled", l.sampler.every)
+	}
+
+	var b bytes.Buffer
+	if l.out.json {
+		b.WriteByte('{')
+	}
+	l.field(&b, "time", time.Now().UTC().Format(time.RFC3339Nano))
+	l.field(&b, "level", level.String())
+	l.field(&b, "msg", msg)
+	l.fieldsOf(&b, l.fields)
+	l.fieldsOf(&b, kv)
+	if l.out.json {
+		b.WriteByte('}')
+	}
+	b.WriteByte('\n')
+
+	l.out.lock.Lock()
+	defer l.out.lock.Unlock()
+
+	l.out.w.Write(b.Bytes())
+}
+
+// fieldsOf writes the key/value pairs in kv. A key without a value is written as the value of !BADKEY.
+func (l *Logger) fieldsOf(b *bytes.Buffer, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 == len(kv) {
+			l.field(b, "!BADKEY", kv[i])
+
+			break
+		}
+
+		l.field(b, fmt.Sprint(kv[i]), kv[i+1])
+	}
+}
+
+func (l *Logger) field(b *bytes.Buffer, key string, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	if l.out.json {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+
+		return
+	}
+
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	b.WriteString(key)
+	b.WriteByte('=')
+
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") || !strconv.CanBackquote(s) {
+		s = strconv.Quote(s)
+	}
+	b.WriteString(s)
+}
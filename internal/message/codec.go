@@ -0,0 +1,503 @@
+package message
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Codec encodes messages for the wire.
+// It is negotiated per connection by the WebSocket subprotocol.
+type Codec interface {
+	// Subprotocol is the WebSocket subprotocol that selects the codec.
+	Subprotocol() string
+	// Binary reports whether the messages are sent in binary frames.
+	Binary() bool
+	Marshal(m *Message) ([]byte, error)
+	Unmarshal(b []byte, m *Message) error
+}
+
+var (
+	JSONCodec   Codec = jsonCodec{}
+	BinaryCodec Codec = binaryCodec{}
+)
+
+// Subprotocols returns the subprotocols of the codecs, preferred first.
+func Subprotocols() []string {
+	return []string{
+		BinaryCodec.Subprotocol(),
+		JSONCodec.Subprotocol(),
+	}
+}
+
+// CodecFor returns the codec of a negotiated subprotocol.
+// Clients that negotiate no subprotocol speak JSON.
+func CodecFor(subprotocol string) Codec {
+	switch subprotocol {
+	case BinaryCodec.Subprotocol():
+		return BinaryCodec
+	default:
+		return JSONCodec
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Subprotocol() string {
+	return "fgo.json"
+}
+
+func (jsonCodec) Binary() bool {
+	return false
+}
+
+func (jsonCodec) Marshal(m *Message) ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (jsonCodec) Unmarshal(b []byte, m *Message) error {
+	return json.Unmarshal(b, m)
+}
+
+// binaryCodec packs messages with varints.
+// A message is its kind, a bit set of the fields present and the fields in declaration order.
+type binaryCodec struct{}
+
+// kinds maps the kinds to their codes in the binary codec. Append only.
+var kinds = []string{
+	KindUpdate,
+	KindJoin,
+	KindLeave,
+	KindStanding,
+	KindStart,
+	KindInput,
+	KindRooms,
+	KindCreate,
+	KindError,
+	KindHello,
+	KindWelcome,
+	KindSubmit,
+	KindShutdown,
+}
+
+// Fields of Message in the binary codec
+const (
+	fieldUser = 1 << iota
+	fieldHello
+	fieldWelcome
+	fieldInput
+	fieldRoom
+	fieldRooms
+	fieldStanding
+	fieldPeriod
+	fieldError
+	fieldRun
+	fieldShutdown
+)
+
+var errShortBuffer = errors.New("message is truncated")
+
+func (binaryCodec) Subprotocol() string {
+	return "fgo.bin"
+}
+
+func (binaryCodec) Binary() bool {
+	return true
+}
+
+func (binaryCodec) Marshal(m *Message) ([]byte, error) {
+	code := -1
+	for i := range kinds {
+		if kinds[i] == m.Kind {
+			code = i
+		}
+	}
+	if code < 0 {
+		return nil, fmt.Errorf("unknown message kind: %s", m.Kind)
+	}
+
+	var fields uint64
+	if m.User != (User{}) {
+		fields |= fieldUser
+	}
+	if m.Hello != nil {
+		fields |= fieldHello
+	}
+	if m.Welcome != nil {
+		fields |= fieldWelcome
+	}
+	if m.Input != nil {
+		fields |= fieldInput
+	}
+	if m.Room != nil {
+		fields |= fieldRoom
+	}
+	if len(m.Rooms) != 0 {
+		fields |= fieldRooms
+	}
+	if len(m.Standing) != 0 {
+		fields |= fieldStanding
+	}
+	if m.Period != "" {
+		fields |= fieldPeriod
+	}
+	if m.Error != "" {
+		fields |= fieldError
+	}
+	if m.Run != nil {
+		fields |= fieldRun
+	}
+	if m.Shutdown != nil {
+		fields |= fieldShutdown
+	}
+
+	e := &encoder{
+		buf: make([]byte, 0, 64),
+	}
+	e.uvarint(uint64(code))
+	e.uvarint(fields)
+
+	if fields&fieldUser != 0 {
+		e.user(&m.User)
+	}
+	if fields&fieldHello != 0 {
+		e.uvarint(uint64(m.Hello.Version))
+		e.string(m.Hello.Build)
+		e.string(m.Hello.Name)
+		e.string(m.Hello.Room)
+		e.strings(m.Hello.Capabilities)
+		e.string(m.Hello.Token)
+		e.bool(m.Hello.Spectator)
+		e.string(m.Hello.Identity)
+	}
+	if fields&fieldWelcome != 0 {
+		e.string(m.Welcome.PlayerID)
+		e.time(m.Welcome.ServerTime)
+		e.varint(m.Welcome.Seed)
+		e.bool(m.Welcome.Room != nil)
+		if m.Welcome.Room != nil {
+			e.room(m.Welcome.Room)
+		}
+		e.strings(m.Welcome.Capabilities)
+		e.string(m.Welcome.Token)
+		e.string(m.Welcome.Name)
+		e.string(m.Welcome.Identity)
+	}
+	if fields&fieldInput != 0 {
+		e.varint(int64(m.Input.Tick))
+		e.bool(m.Input.Jump)
+	}
+	if fields&fieldRoom != 0 {
+		e.room(m.Room)
+	}
+	if fields&fieldRooms != 0 {
+		e.uvarint(uint64(len(m.Rooms)))
+		for i := range m.Rooms {
+			e.room(&m.Rooms[i])
+		}
+	}
+	if fields&fieldStanding != 0 {
+		e.uvarint(uint64(len(m.Standing)))
+		for i := range m.Standing {
+			e.string(m.Standing[i].Name)
+			e.varint(int64(m.Standing[i].Score))
+		}
+	}
+	if fields&fieldPeriod != 0 {
+		e.string(m.Period)
+	}
+	if fields&fieldError != 0 {
+		e.string(m.Error)
+	}
+	if fields&fieldRun != 0 {
+		e.varint(m.Run.Seed)
+		e.uvarint(uint64(len(m.Run.Jumps)))
+		for _, tick := range m.Run.Jumps {
+			e.varint(int64(tick))
+		}
+		e.varint(int64(m.Run.Score))
+		e.time(m.Run.At)
+	}
+	if fields&fieldShutdown != 0 {
+		e.varint(int64(m.Shutdown.ReconnectAfter))
+	}
+
+	return e.buf, nil
+}
+
+func (binaryCodec) Unmarshal(b []byte, m *Message) error {
+	d := &decoder{
+		buf: b,
+	}
+
+	code := d.uvarint()
+	fields := d.uvarint()
+	if d.err != nil {
+		return d.err
+	}
+	if code >= uint64(len(kinds)) {
+		return fmt.Errorf("unknown message kind code: %d", code)
+	}
+
+	*m = Message{
+		Kind: kinds[code],
+	}
+
+	if fields&fieldUser != 0 {
+		d.user(&m.User)
+	}
+	if fields&fieldHello != 0 {
+		m.Hello = &Hello{
+			Version:      int(d.uvarint()),
+			Build:        d.string(),
+			Name:         d.string(),
+			Room:         d.string(),
+			Capabilities: d.strings(),
+			Token:        d.string(),
+			Spectator:    d.bool(),
+			Identity:     d.string(),
+		}
+	}
+	if fields&fieldWelcome != 0 {
+		m.Welcome = &Welcome{
+			PlayerID:   d.string(),
+			ServerTime: d.time(),
+			Seed:       d.varint(),
+		}
+		if d.bool() {
+			m.Welcome.Room = &Room{}
+			d.room(m.Welcome.Room)
+		}
+		m.Welcome.Capabilities = d.strings()
+		m.Welcome.Token = d.string()
+		m.Welcome.Name = d.string()
+		m.Welcome.Identity = d.string()
+	}
+	if fields&fieldInput != 0 {
+		m.Input = &Input{
+			Tick: int(d.varint()),
+			Jump: d.bool(),
+		}
+	}
+	if fields&fieldRoom != 0 {
+		m.Room = &Room{}
+		d.room(m.Room)
+	}
+	if fields&fieldRooms != 0 {
+		m.Rooms = make([]Room, d.length())
+		for i := range m.Rooms {
+			d.room(&m.Rooms[i])
+		}
+	}
+	if fields&fieldStanding != 0 {
+		m.Standing = make([]Result, d.length())
+		for i := range m.Standing {
+			m.Standing[i].Name = d.string()
+			m.Standing[i].Score = int(d.varint())
+		}
+	}
+	if fields&fieldPeriod != 0 {
+		m.Period = d.string()
+	}
+	if fields&fieldError != 0 {
+		m.Error = d.string()
+	}
+	if fields&fieldRun != 0 {
+		m.Run = &Run{
+			Seed: d.varint(),
+		}
+		if n := d.length(); n != 0 {
+			m.Run.Jumps = make([]int, n)
+		}
+		for i := range m.Run.Jumps {
+			m.Run.Jumps[i] = int(d.varint())
+		}
+		m.Run.Score = int(d.varint())
+		m.Run.At = d.time()
+	}
+	if fields&fieldShutdown != 0 {
+		m.Shutdown = &Shutdown{
+			ReconnectAfter: time.Duration(d.varint()),
+		}
+	}
+
+	return d.err
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (e *encoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) strings(s []string) {
+	e.uvarint(uint64(len(s)))
+	for i := range s {
+		e.string(s[i])
+	}
+}
+
+// time writes whether t is set and then its Unix time in nanoseconds.
+// UnixNano is undefined for the zero time, so it is written as unset.
+func (e *encoder) time(t time.Time) {
+	e.bool(!t.IsZero())
+	if !t.IsZero() {
+		e.varint(t.UnixNano())
+	}
+}
+
+func (e *encoder) user(u *User) {
+	e.string(u.ID)
+	e.string(u.Name)
+	e.varint(int64(u.X16))
+	e.varint(int64(u.Y16))
+	e.varint(int64(u.VY16))
+	e.bool(u.Running)
+	e.varint(int64(u.Score))
+	e.varint(int64(u.Tick))
+}
+
+func (e *encoder) room(r *Room) {
+	e.string(r.Code)
+	e.string(r.Name)
+	e.bool(r.Public)
+	e.varint(int64(r.Players))
+	e.varint(int64(r.MaxPlayers))
+	e.varint(r.Seed)
+}
+
+// decoder reads what encoder wrote. The first error sticks and later reads return zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	d.buf = nil
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail(errShortBuffer)
+
+		return 0
+	}
+	d.buf = d.buf[n:]
+
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail(errShortBuffer)
+
+		return 0
+	}
+	d.buf = d.buf[n:]
+
+	return v
+}
+
+func (d *decoder) bool() bool {
+	if len(d.buf) == 0 {
+		d.fail(errShortBuffer)
+
+		return false
+	}
+	v := d.buf[0] != 0
+	d.buf = d.buf[1:]
+
+	return v
+}
+
+// length reads the length of a list or string, which cannot exceed the remaining bytes.
+func (d *decoder) length() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail(errShortBuffer)
+
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	var b strings.Builder
+	b.Write(d.buf[:n])
+	d.buf = d.buf[n:]
+
+	return b.String()
+}
+
+func (d *decoder) strings() []string {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+
+	s := make([]string, n)
+	for i := range s {
+		s[i] = d.string()
+	}
+
+	return s
+}
+
+func (d *decoder) time() time.Time {
+	if !d.bool() {
+		return time.Time{}
+	}
+
+	return time.Unix(0, d.varint()).UTC()
+}
+
+func (d *decoder) user(u *User) {
+	u.ID = d.string()
+	u.Name = d.string()
+	u.X16 = int(d.varint())
+	u.Y16 = int(d.varint())
+	u.VY16 = int(d.varint())
+	u.Running = d.bool()
+	u.Score = int(d.varint())
+	u.Tick = int(d.varint())
+}
+
+func (d *decoder) room(r *Room) {
+	r.Code = d.string()
+	r.Name = d.string()
+	r.Public = d.bool()
+	r.Players = int(d.varint())
+	r.MaxPlayers = int(d.varint())
+	r.Seed = d.varint()
+}
@@ -0,0 +1,217 @@
+package message
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var at = time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+
+var codecTests = []struct {
+	name string
+	m    Message
+}{
+	{
+		name: "empty update",
+		m:    Message{Kind: KindUpdate},
+	},
+	{
+		name: "update",
+		m: Message{
+			Kind: KindUpdate,
+			User: User{ID: "p1", Name: "Gopher", X16: 1 << 20, Y16: -3, VY16: -1 << 10, Running: true, Score: 12, Tick: 3456},
+		},
+	},
+	{
+		name: "hello",
+		m: Message{
+			Kind: KindHello,
+			Hello: &Hello{
+				Version:      ProtocolVersion,
+				Build:        "dev",
+				Name:         "ゴーファー",
+				Room:         "ABCD",
+				Capabilities: []string{CapabilityRooms, CapabilityBoards, CapabilitySpectate},
+				Token:        "token",
+				Spectator:    true,
+				Identity:     "identity",
+			},
+		},
+	},
+	{
+		name: "empty hello",
+		m:    Message{Kind: KindHello, Hello: &Hello{}},
+	},
+	{
+		name: "welcome",
+		m: Message{
+			Kind: KindWelcome,
+			Welcome: &Welcome{
+				PlayerID:     "p1",
+				ServerTime:   at,
+				Seed:         -42,
+				Room:         &Room{Code: "ABCD", Name: "room", Public: true, Players: 2, MaxPlayers: 8, Seed: -42},
+				Capabilities: []string{CapabilityRooms},
+				Token:        "token",
+				Name:         "Gopher (2)",
+				Identity:     "identity",
+			},
+		},
+	},
+	{
+		name: "welcome with zero time",
+		m:    Message{Kind: KindWelcome, Welcome: &Welcome{}},
+	},
+	{
+		name: "input",
+		m:    Message{Kind: KindInput, Input: &Input{Tick: 120, Jump: true}},
+	},
+	{
+		name: "zero input",
+		m:    Message{Kind: KindInput, Input: &Input{}},
+	},
+	{
+		name: "join",
+		m:    Message{Kind: KindJoin, Room: &Room{Code: "ABCD"}},
+	},
+	{
+		name: "rooms",
+		m: Message{
+			Kind:  KindRooms,
+			Rooms: []Room{{Code: "ABCD", Public: true, Players: 1, MaxPlayers: 8}, {}},
+		},
+	},
+	{
+		name: "standing",
+		m: Message{
+			Kind:     KindStanding,
+			Standing: []Result{{Name: "a", Score: 3}, {}},
+			Period:   PeriodWeekly,
+		},
+	},
+	{
+		name: "error",
+		m:    Message{Kind: KindError, Error: "room is full"},
+	},
+	{
+		name: "submit",
+		m: Message{
+			Kind: KindSubmit,
+			Run:  &Run{Seed: 1 << 40, Jumps: []int{0, 15, 40, 1 << 20}, Score: 7, At: at},
+		},
+	},
+	{
+		name: "submit without jumps or time",
+		m:    Message{Kind: KindSubmit, Run: &Run{}},
+	},
+	{
+		name: "shutdown",
+		m:    Message{Kind: KindShutdown, Shutdown: &Shutdown{ReconnectAfter: 5 * time.Second}},
+	},
+	{
+		name: "zero shutdown",
+		m:    Message{Kind: KindShutdown, Shutdown: &Shutdown{}},
+	},
+}
+
+func TestCodecs(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, BinaryCodec} {
+		for _, tc := range codecTests {
+			b, err := codec.Marshal(&tc.m)
+			if err != nil {
+				t.Errorf("%s: %s: Marshal failed: %v", codec.Subprotocol(), tc.name, err)
+
+				continue
+			}
+
+			var m Message
+			if err := codec.Unmarshal(b, &m); err != nil {
+				t.Errorf("%s: %s: Unmarshal failed: %v", codec.Subprotocol(), tc.name, err)
+
+				continue
+			}
+
+			if !reflect.DeepEqual(m, tc.m) {
+				t.Errorf("%s: %s: got %#v, want %#v", codec.Subprotocol(), tc.name, m, tc.m)
+			}
+		}
+	}
+}
+
+func TestBinaryCodecZeroTime(t *testing.T) {
+	b, err := BinaryCodec.Marshal(&Message{Kind: KindSubmit, Run: &Run{Score: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m Message
+	if err := BinaryCodec.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.Run.At.IsZero() {
+		t.Errorf("zero time decoded as %v", m.Run.At)
+	}
+}
+
+func TestBinaryCodecErrors(t *testing.T) {
+	if _, err := BinaryCodec.Marshal(&Message{Kind: "unknown"}); err == nil {
+		t.Error("unknown kind was marshaled")
+	}
+
+	var m Message
+	if err := BinaryCodec.Unmarshal([]byte{byte(len(kinds))}, &m); err == nil {
+		t.Error("unknown kind code was unmarshaled")
+	}
+
+	for _, tc := range codecTests {
+		b, err := BinaryCodec.Marshal(&tc.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for n := 0; n < len(b); n++ {
+			if err := BinaryCodec.Unmarshal(b[:n], &m); err == nil {
+				t.Errorf("%s: truncated to %d of %d bytes was unmarshaled", tc.name, n, len(b))
+			}
+		}
+	}
+}
+
+var benchmarkMessage = Message{
+	Kind: KindUpdate,
+	User: User{ID: "0123456789abcdef", Name: "Gopher", X16: 1 << 20, Y16: 200 << 16, VY16: -1 << 10, Running: true, Score: 12, Tick: 3456},
+}
+
+func benchmarkMarshal(b *testing.B, codec Codec) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := codec.Marshal(&benchmarkMessage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkUnmarshal(b *testing.B, codec Codec) {
+	buf, err := codec.Marshal(&benchmarkMessage)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+
+	var m Message
+	for i := 0; i < b.N; i++ {
+		if err := codec.Unmarshal(buf, &m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONMarshal(b *testing.B)     { benchmarkMarshal(b, JSONCodec) }
+func BenchmarkBinaryMarshal(b *testing.B)   { benchmarkMarshal(b, BinaryCodec) }
+func BenchmarkJSONUnmarshal(b *testing.B)   { benchmarkUnmarshal(b, JSONCodec) }
+func BenchmarkBinaryUnmarshal(b *testing.B) { benchmarkUnmarshal(b, BinaryCodec) }
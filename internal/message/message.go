@@ -1,10 +1,35 @@
 package message
 
+import "time"
+
+// ProtocolVersion is incremented on every incompatible change of the protocol.
+const ProtocolVersion = 6
+
+// WebSocket close codes of the server besides the ones in RFC 6455
+const (
+	// CloseIncompatible is for clients speaking another protocol version.
+	CloseIncompatible = 4000
+	// CloseRateLimited is for clients sending messages faster than the server accepts them.
+	CloseRateLimited = 4001
+	// CloseIdle is for players that have sent nothing for too long and spectators that did not answer a ping.
+	CloseIdle = 4002
+	// CloseConnectedElsewhere is for clients whose player is already connected from another tab.
+	CloseConnectedElsewhere = 4003
+)
+
+// Capabilities a client can announce in Hello
+const (
+	CapabilityRooms    = "rooms"
+	CapabilityBoards   = "boards"
+	CapabilitySpectate = "spectate"
+)
+
 type User struct {
 	ID, Name       string
 	X16, Y16, VY16 int
 	Running        bool
 	Score          int
+	Tick           int
 }
 
 const (
@@ -12,6 +37,22 @@ const (
 	KindJoin     = "join"
 	KindLeave    = "leave"
 	KindStanding = "standing"
+	KindStart    = "start"
+	KindInput    = "input"
+	KindRooms    = "rooms"
+	KindCreate   = "create"
+	KindError    = "error"
+	KindHello    = "hello"
+	KindWelcome  = "welcome"
+	KindSubmit   = "submit"
+	KindShutdown = "shutdown"
+)
+
+// Periods of leaderboards
+const (
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodAllTime = "alltime"
 )
 
 type Result struct {
@@ -19,10 +60,83 @@ type Result struct {
 	Score int
 }
 
+// Input is a jump input of a player at the given simulation tick.
+type Input struct {
+	Tick int
+	Jump bool
+}
+
+// Run is a finished run on the course of Seed, given as the ticks the player jumped at.
+type Run struct {
+	Seed  int64
+	Jumps []int
+	Score int
+	At    time.Time
+}
+
+// Room describes a room players fly together in.
+// Every player in a room shares its course seed.
+type Room struct {
+	Code       string
+	Name       string `json:",omitempty"`
+	Public     bool
+	Players    int
+	MaxPlayers int
+	Seed       int64 `json:",omitempty"`
+}
+
+// Shutdown tells the clients that the server is going away.
+type Shutdown struct {
+	// ReconnectAfter is how long clients should wait before they reconnect.
+	ReconnectAfter time.Duration
+}
+
+// Hello is the first message a client sends.
+type Hello struct {
+	Version int
+	Build   string
+	Name    string
+	// Room is the code of the room to join. The daily room is joined if it is empty.
+	Room         string   `json:",omitempty"`
+	Capabilities []string `json:",omitempty"`
+	// Token is the session token of an earlier connection to resume its player.
+	Token string `json:",omitempty"`
+	// Spectator watches the room without playing.
+	Spectator bool `json:",omitempty"`
+	// Identity is the identity token from an earlier visit, which keeps the player ID.
+	Identity string `json:",omitempty"`
+}
+
+// Welcome is the answer to Hello. Room is nil if the client could not join any room.
+type Welcome struct {
+	PlayerID     string
+	ServerTime   time.Time
+	Seed         int64
+	Room         *Room    `json:",omitempty"`
+	Capabilities []string `json:",omitempty"`
+	// Token resumes the player on a later connection.
+	Token string
+	// Name is the name of the player in Room, given by the server.
+	Name string `json:",omitempty"`
+	// Identity is the identity token the client keeps for later visits.
+	Identity string
+}
+
 type Message struct {
 	Kind     string
 	User     User
+	Hello    *Hello   `json:",omitempty"`
+	Welcome  *Welcome `json:",omitempty"`
+	Input    *Input   `json:",omitempty"`
+	Run      *Run     `json:",omitempty"`
+	Room     *Room    `json:",omitempty"`
+	Rooms    []Room   `json:",omitempty"`
 	Standing []Result `json:",omitempty"`
+	// Period is the leaderboard period of Standing. It is empty for the standing of the room.
+	Period string `json:",omitempty"`
+	Error  string `json:",omitempty"`
+	// Shutdown is the notice of a KindShutdown message.
+	Shutdown *Shutdown `json:",omitempty"`
 }
 
 func (m *Message) Validate() bool {
@@ -32,6 +146,47 @@ func (m *Message) Validate() bool {
 	case KindLeave:
 
 	case KindStanding:
+		switch m.Period {
+		case "", PeriodDaily, PeriodWeekly, PeriodAllTime:
+		default:
+			return false
+		}
+
+	case KindStart:
+
+	case KindInput:
+		if m.Input == nil || m.Input.Tick < 0 {
+			return false
+		}
+
+	case KindSubmit:
+		if m.Run == nil || m.Run.Score < 0 {
+			return false
+		}
+
+	case KindJoin, KindCreate:
+		if m.Room == nil {
+			return false
+		}
+
+	case KindRooms:
+
+	case KindError:
+
+	case KindHello:
+		if m.Hello == nil {
+			return false
+		}
+
+	case KindWelcome:
+		if m.Welcome == nil {
+			return false
+		}
+
+	case KindShutdown:
+		if m.Shutdown == nil {
+			return false
+		}
 
 	default:
 		return false
@@ -0,0 +1,123 @@
+// Package replay records runs as compact input logs and plays them back with the shared physics.
+package replay
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/sim"
+)
+
+// magic starts every encoded replay, followed by the format version.
+const (
+	magic   = "FGR"
+	version = 1
+)
+
+var errTruncated = errors.New("replay is truncated")
+
+// Marshal encodes run as the seed, the score, the end time and the jump ticks as deltas, all in varints.
+func Marshal(run *message.Run) []byte {
+	b := make([]byte, 0, len(magic)+1+4*binary.MaxVarintLen64+2*len(run.Jumps))
+	b = append(b, magic...)
+	b = append(b, version)
+
+	var buf [binary.MaxVarintLen64]byte
+	b = append(b, buf[:binary.PutVarint(buf[:], run.Seed)]...)
+	b = append(b, buf[:binary.PutVarint(buf[:], int64(run.Score))]...)
+	b = append(b, buf[:binary.PutVarint(buf[:], run.At.Unix())]...)
+	b = append(b, buf[:binary.PutUvarint(buf[:], uint64(len(run.Jumps)))]...)
+
+	prev := 0
+	for _, tick := range run.Jumps {
+		b = append(b, buf[:binary.PutVarint(buf[:], int64(tick-prev))]...)
+		prev = tick
+	}
+
+	return b
+}
+
+// Unmarshal decodes a replay encoded by Marshal.
+func Unmarshal(b []byte) (*message.Run, error) {
+	if len(b) < len(magic)+1 || string(b[:len(magic)]) != magic {
+		return nil, errors.New("not a replay")
+	}
+	if v := b[len(magic)]; v != version {
+		return nil, fmt.Errorf("unsupported replay version: %d", v)
+	}
+	b = b[len(magic)+1:]
+
+	var err error
+	varint := func() int64 {
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			err = errTruncated
+			b = nil
+
+			return 0
+		}
+		b = b[n:]
+
+		return v
+	}
+
+	run := &message.Run{
+		Seed:  varint(),
+		Score: int(varint()),
+		At:    time.Unix(varint(), 0),
+	}
+
+	count, n := binary.Uvarint(b)
+	if n <= 0 || count > uint64(len(b)) {
+		return nil, errTruncated
+	}
+	b = b[n:]
+
+	run.Jumps = make([]int, count)
+	prev := 0
+	for i := range run.Jumps {
+		prev += int(varint())
+		run.Jumps[i] = prev
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// Player plays a run back tick by tick.
+type Player struct {
+	World *sim.World
+	jumps []int
+}
+
+func NewPlayer(run *message.Run) *Player {
+	return &Player{
+		World: sim.NewWorld(sim.NewCourse(run.Seed)),
+		jumps: run.Jumps,
+	}
+}
+
+// Step advances the run by one tick. It reports whether the gopher jumped and whether it hit something.
+func (p *Player) Step() (jumped, hit bool) {
+	if !p.World.Body.Running {
+		return false, false
+	}
+
+	for len(p.jumps) != 0 && p.jumps[0] < p.World.Body.Tick {
+		p.jumps = p.jumps[1:]
+	}
+	jumped = len(p.jumps) != 0 && p.jumps[0] == p.World.Body.Tick
+
+	return jumped, p.World.Step(sim.Input{Jump: jumped})
+}
+
+// Done reports whether the run is over.
+func (p *Player) Done() bool {
+	return !p.World.Body.Running
+}
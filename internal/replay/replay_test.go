@@ -0,0 +1,63 @@
+package replay
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+)
+
+func TestMarshal(t *testing.T) {
+	for _, run := range []*message.Run{
+		{Seed: 20240506, Jumps: []int{0, 12, 30, 31, 500}, Score: 3, At: time.Unix(1715000000, 0)},
+		{Seed: -7, Jumps: []int{}, At: time.Unix(0, 0)},
+		{Seed: 1 << 62, Jumps: []int{1 << 20}, Score: 1 << 20, At: time.Unix(-1, 0)},
+	} {
+		got, err := Unmarshal(Marshal(run))
+		if err != nil {
+			t.Errorf("seed %d: %v", run.Seed, err)
+
+			continue
+		}
+		if !reflect.DeepEqual(got, run) {
+			t.Errorf("seed %d: decoded %+v, want %+v", run.Seed, got, run)
+		}
+	}
+}
+
+func TestMarshalDropsSubseconds(t *testing.T) {
+	run := &message.Run{Jumps: []int{}, At: time.Unix(100, 999)}
+	got, err := Unmarshal(Marshal(run))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.At.Equal(time.Unix(100, 0)) {
+		t.Errorf("decoded the time %v", got.At)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	b := Marshal(&message.Run{Seed: 1, Jumps: []int{10, 20, 30}, Score: 1, At: time.Unix(1715000000, 0)})
+
+	for i := 0; i < len(b); i++ {
+		if _, err := Unmarshal(b[:i]); err == nil {
+			t.Errorf("decoded the replay truncated to %d bytes", i)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		b    []byte
+	}{
+		{name: "empty"},
+		{name: "other magic", b: append([]byte("XYZ"), b[len(magic):]...)},
+		{name: "other version", b: append([]byte(magic+"\x02"), b[len(magic)+1:]...)},
+		// The count of jumps is larger than the rest of the replay.
+		{name: "too many jumps", b: []byte(magic + "\x01\x02\x02\x02\x7f")},
+	} {
+		if _, err := Unmarshal(tc.b); err == nil {
+			t.Errorf("%s: decoded", tc.name)
+		}
+	}
+}
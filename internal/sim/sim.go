@@ -0,0 +1,230 @@
+// Package sim implements the gopher physics shared by the game client and the server.
+// It has no dependency on ebiten so that the server can run the same simulation
+// as the client from jump inputs only.
+package sim
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	// TPS is the number of simulation steps per second.
+	TPS = 60
+
+	ScreenHeight     = 480
+	TileSize         = 32
+	PipeWidth        = TileSize * 2
+	PipeStartOffsetX = 8
+	PipeIntervalX    = 8
+	PipeGapY         = 5
+
+	// GopherImageWidth and GopherImageHeight are the size of the gopher sprite.
+	// The hit box is centered in it.
+	GopherImageWidth  = 60
+	GopherImageHeight = 75
+	gopherWidth       = 30
+	gopherHeight      = 60
+
+	courseLength = 256
+)
+
+func FloorDiv(x, y int) int {
+	d := x / y
+	if d*y == x || x >= 0 {
+		return d
+	}
+	return d - 1
+}
+
+func FloorMod(x, y int) int {
+	return x - FloorDiv(x, y)*y
+}
+
+type PipeAtFn func(tileX int) (tileY int, ok bool)
+
+// Course is the sequence of pipes a gopher flies through.
+// The same seed always produces the same course.
+type Course struct {
+	pipeTileYs []int
+}
+
+// DailySeed returns the course seed of the day t falls on in its location.
+func DailySeed(t time.Time) int64 {
+	y, m, d := t.Date()
+
+	return int64(y*10000 + int(m)*100 + d)
+}
+
+func NewCourse(seed int64) *Course {
+	r := rand.New(rand.NewSource(seed))
+
+	c := &Course{
+		pipeTileYs: make([]int, courseLength),
+	}
+	for i := range c.pipeTileYs {
+		c.pipeTileYs[i] = r.Intn(6) + 2
+	}
+
+	return c
+}
+
+func (c *Course) PipeAt(tileX int) (tileY int, ok bool) {
+	if (tileX - PipeStartOffsetX) <= 0 {
+		return 0, false
+	}
+	if FloorMod(tileX-PipeStartOffsetX, PipeIntervalX) != 0 {
+		return 0, false
+	}
+	idx := FloorDiv(tileX-PipeStartOffsetX, PipeIntervalX)
+	return c.pipeTileYs[idx%len(c.pipeTileYs)], true
+}
+
+// Body is the physical state of a gopher.
+type Body struct {
+	X16, Y16, VY16 int
+	Running        bool
+
+	// Tick is the number of steps simulated since the run started.
+	Tick int
+}
+
+func NewBody() Body {
+	return Body{
+		Y16:     100 * 16,
+		Running: true,
+	}
+}
+
+func (b *Body) Reset() {
+	*b = NewBody()
+}
+
+// Step advances the body by one tick and reports whether it hit something.
+func (b *Body) Step(jump bool, pipeAtFn PipeAtFn) bool {
+	if !b.Running {
+		return false
+	}
+
+	b.Tick++
+	b.X16 += 32
+	if jump {
+		b.VY16 = -96
+	}
+	b.Y16 += b.VY16
+
+	// Gravity
+	b.VY16 += 4
+	if b.VY16 > 96 {
+		b.VY16 = 96
+	}
+
+	if b.Hit(pipeAtFn) {
+		b.Running = false
+
+		return true
+	}
+
+	return false
+}
+
+func (b *Body) Hit(pipeAtFn PipeAtFn) bool {
+	if pipeAtFn == nil {
+		return false
+	}
+
+	x0 := FloorDiv(b.X16, 16) + (GopherImageWidth-gopherWidth)/2
+	y0 := FloorDiv(b.Y16, 16) + (GopherImageHeight-gopherHeight)/2
+	x1 := x0 + gopherWidth
+	y1 := y0 + gopherHeight
+	if y0 < -TileSize*4 {
+		return true
+	}
+	if y1 >= ScreenHeight-TileSize {
+		return true
+	}
+	xMin := FloorDiv(x0-PipeWidth, TileSize)
+	xMax := FloorDiv(x0+gopherWidth, TileSize)
+	for x := xMin; x <= xMax; x++ {
+		y, ok := pipeAtFn(x)
+		if !ok {
+			continue
+		}
+		if x0 >= x*TileSize+PipeWidth {
+			continue
+		}
+		if x1 < x*TileSize {
+			continue
+		}
+		if y0 < y*TileSize {
+			return true
+		}
+		if y1 >= (y+PipeGapY)*TileSize {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Body) Score() int {
+	x := FloorDiv(b.X16, 16) / TileSize
+	if (x - PipeStartOffsetX) <= 0 {
+		return 0
+	}
+	return FloorDiv(x-PipeStartOffsetX, PipeIntervalX)
+}
+
+// Input is the player input of a single step.
+type Input struct {
+	Jump bool
+}
+
+// World is a gopher flying through a course.
+// Step is deterministic, so replaying the same inputs reproduces the same run.
+type World struct {
+	Course *Course
+	Body   Body
+}
+
+func NewWorld(course *Course) *World {
+	return &World{
+		Course: course,
+		Body:   NewBody(),
+	}
+}
+
+func (w *World) Reset() {
+	w.Body.Reset()
+}
+
+// Step advances the world by one tick and reports whether the gopher hit a pipe or the ground.
+func (w *World) Step(in Input) bool {
+	return w.Body.Step(in.Jump, w.Course.PipeAt)
+}
+
+// AdvanceTo steps the world without input until it reaches tick or the gopher stops.
+// It reports whether the gopher hit something on the way.
+func (w *World) AdvanceTo(tick int) bool {
+	for w.Body.Running && w.Body.Tick < tick {
+		if w.Step(Input{}) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Replay plays a run that jumped at the given ticks until the gopher hits something.
+// Jumps must be in ascending order. Jumps after the hit are ignored.
+func (w *World) Replay(jumps []int) {
+	for _, tick := range jumps {
+		if w.AdvanceTo(tick) || !w.Body.Running {
+			return
+		}
+		w.Step(Input{Jump: true})
+	}
+
+	for w.Body.Running {
+		w.Step(Input{})
+	}
+}
@@ -0,0 +1,223 @@
+package sim
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewCourse(t *testing.T) {
+	a, b := NewCourse(42), NewCourse(42)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("courses of the same seed differ")
+	}
+	if reflect.DeepEqual(a, NewCourse(43)) {
+		t.Error("courses of different seeds are the same")
+	}
+
+	for i, y := range a.pipeTileYs {
+		if y < 2 || y+PipeGapY > ScreenHeight/TileSize-1 {
+			t.Errorf("pipe %d has its gap at %d, out of the screen", i, y)
+		}
+	}
+}
+
+func TestPipeAt(t *testing.T) {
+	c := NewCourse(1)
+
+	for _, tc := range []struct {
+		tileX int
+		idx   int
+		ok    bool
+	}{
+		{tileX: -8},
+		{tileX: 0},
+		{tileX: PipeStartOffsetX},
+		{tileX: PipeStartOffsetX + 1},
+		{tileX: PipeStartOffsetX + PipeIntervalX, idx: 1, ok: true},
+		{tileX: PipeStartOffsetX + PipeIntervalX*2, idx: 2, ok: true},
+		{tileX: PipeStartOffsetX + PipeIntervalX*(courseLength+1), idx: 1, ok: true},
+	} {
+		y, ok := c.PipeAt(tc.tileX)
+		if ok != tc.ok {
+			t.Errorf("PipeAt(%d) reported %v, want %v", tc.tileX, ok, tc.ok)
+
+			continue
+		}
+		if ok && y != c.pipeTileYs[tc.idx] {
+			t.Errorf("PipeAt(%d) = %d, want %d", tc.tileX, y, c.pipeTileYs[tc.idx])
+		}
+	}
+}
+
+func TestDailySeed(t *testing.T) {
+	if seed := DailySeed(time.Date(2024, 5, 6, 23, 59, 0, 0, time.UTC)); seed != 20240506 {
+		t.Errorf("DailySeed = %d, want 20240506", seed)
+	}
+}
+
+// onePipe has a pipe at tile 10 whose gap starts at tile 5.
+func onePipe(tileX int) (int, bool) {
+	return 5, tileX == 10
+}
+
+func noPipes(tileX int) (int, bool) {
+	return 0, false
+}
+
+// bodyAt returns a body whose hit box has its top left corner at x0, y0 in pixels.
+func bodyAt(x0, y0 int) Body {
+	return Body{
+		X16:     (x0 - (GopherImageWidth-gopherWidth)/2) * 16,
+		Y16:     (y0 - (GopherImageHeight-gopherHeight)/2) * 16,
+		Running: true,
+	}
+}
+
+func TestHit(t *testing.T) {
+	const (
+		pipeLeft   = 10 * TileSize
+		pipeRight  = pipeLeft + PipeWidth
+		gapTop     = 5 * TileSize
+		gapBottom  = (5 + PipeGapY) * TileSize
+		floor      = ScreenHeight - TileSize
+		ceiling    = -TileSize * 4
+		inGapY     = gapTop + 10
+		beforePipe = pipeLeft - gopherWidth - 10
+	)
+
+	for _, tc := range []struct {
+		name   string
+		x0, y0 int
+		pipes  PipeAtFn
+		hit    bool
+	}{
+		{name: "no course", x0: beforePipe, y0: floor},
+		{name: "above the floor", x0: beforePipe, y0: floor - gopherHeight - 1, pipes: noPipes},
+		{name: "on the floor", x0: beforePipe, y0: floor - gopherHeight, pipes: noPipes, hit: true},
+		{name: "at the ceiling", x0: beforePipe, y0: ceiling, pipes: noPipes},
+		{name: "above the ceiling", x0: beforePipe, y0: ceiling - 1, pipes: noPipes, hit: true},
+
+		{name: "before the left edge", x0: pipeLeft - gopherWidth - 1, y0: 0, pipes: onePipe},
+		{name: "on the left edge", x0: pipeLeft - gopherWidth, y0: 0, pipes: onePipe, hit: true},
+		{name: "on the right edge", x0: pipeRight - 1, y0: 0, pipes: onePipe, hit: true},
+		{name: "past the right edge", x0: pipeRight, y0: 0, pipes: onePipe},
+
+		{name: "at the top of the gap", x0: pipeLeft, y0: gapTop, pipes: onePipe},
+		{name: "above the gap", x0: pipeLeft, y0: gapTop - 1, pipes: onePipe, hit: true},
+		{name: "at the bottom of the gap", x0: pipeLeft, y0: gapBottom - gopherHeight - 1, pipes: onePipe},
+		{name: "below the gap", x0: pipeLeft, y0: gapBottom - gopherHeight, pipes: onePipe, hit: true},
+		{name: "in the gap on the left edge", x0: pipeLeft - gopherWidth, y0: inGapY, pipes: onePipe},
+		{name: "in the gap on the right edge", x0: pipeRight - 1, y0: inGapY, pipes: onePipe},
+	} {
+		b := bodyAt(tc.x0, tc.y0)
+		if hit := b.Hit(tc.pipes); hit != tc.hit {
+			t.Errorf("%s: Hit() = %v, want %v", tc.name, hit, tc.hit)
+		}
+	}
+}
+
+func TestStep(t *testing.T) {
+	b := NewBody()
+	if b.Step(true, noPipes) {
+		t.Fatal("hit on the first step")
+	}
+	if want := (Body{X16: 32, Y16: 100*16 - 96, VY16: -92, Running: true, Tick: 1}); b != want {
+		t.Errorf("got %+v after a jump, want %+v", b, want)
+	}
+
+	for i := 0; i < 100; i++ {
+		b.Step(false, noPipes)
+	}
+	if b.VY16 != 96 {
+		t.Errorf("falling at %d, want the terminal velocity 96", b.VY16)
+	}
+
+	// The step that reaches the floor stops the body.
+	b = bodyAt(0, ScreenHeight-TileSize-gopherHeight-1)
+	b.VY16 = 16
+	if !b.Step(false, noPipes) {
+		t.Fatal("did not hit the floor")
+	}
+	if b.Running || b.Tick != 1 {
+		t.Errorf("got %+v after the hit, want it stopped at tick 1", b)
+	}
+
+	stopped := b
+	if b.Step(true, noPipes) || b != stopped {
+		t.Error("a stopped body moved")
+	}
+
+	// The step that reaches a pipe stops the body.
+	b = bodyAt(10*TileSize-gopherWidth-1, 0)
+	if !b.Step(false, onePipe) {
+		t.Error("did not hit the pipe")
+	}
+}
+
+// play flies the course of seed, jumping whenever the gopher falls to the bottom of the gap
+// of the pipe ahead, and returns the world and the ticks it jumped at.
+func play(seed int64) (*World, []int) {
+	w := NewWorld(NewCourse(seed))
+
+	var jumps []int
+	for w.Body.Running && w.Body.Tick < 60*TPS {
+		x0 := FloorDiv(w.Body.X16, 16) + (GopherImageWidth-gopherWidth)/2
+		y1 := FloorDiv(w.Body.Y16, 16) + (GopherImageHeight-gopherHeight)/2 + gopherHeight
+
+		gapY, ok := 0, false
+		for x := FloorDiv(x0-PipeWidth, TileSize) + 1; !ok; x++ {
+			gapY, ok = w.Course.PipeAt(x)
+		}
+
+		tick := w.Body.Tick
+		jump := w.Body.VY16 > 0 && y1 > (gapY+PipeGapY)*TileSize-12
+		w.Step(Input{Jump: jump})
+		if jump {
+			jumps = append(jumps, tick)
+		}
+	}
+
+	return w, jumps
+}
+
+func TestReplay(t *testing.T) {
+	for _, seed := range []int64{1, 20240506, -7} {
+		played, jumps := play(seed)
+		if played.Body.Score() < 3 {
+			t.Fatalf("seed %d: the recorded run only scored %d", seed, played.Body.Score())
+		}
+
+		// The run ends at the first hit, so stop the played one there too.
+		for played.Body.Running {
+			played.Step(Input{})
+		}
+
+		w := NewWorld(NewCourse(seed))
+		w.Replay(jumps)
+		if w.Body != played.Body {
+			t.Errorf("seed %d: replayed %+v, played %+v", seed, w.Body, played.Body)
+		}
+
+		// Jumps after the hit are ignored.
+		w = NewWorld(NewCourse(seed))
+		w.Replay(append(jumps[:len(jumps):len(jumps)], played.Body.Tick+10, played.Body.Tick+20))
+		if w.Body != played.Body {
+			t.Errorf("seed %d: jumps after the hit changed the replay to %+v", seed, w.Body)
+		}
+	}
+}
+
+func TestAdvanceTo(t *testing.T) {
+	w := NewWorld(NewCourse(1))
+	if w.AdvanceTo(10) || w.Body.Tick != 10 {
+		t.Fatalf("advanced to tick %d", w.Body.Tick)
+	}
+
+	if !w.AdvanceTo(10 * TPS) {
+		t.Error("a gopher that never jumps did not hit the floor")
+	}
+	if w.Body.Running {
+		t.Error("still running after the hit")
+	}
+}
@@ -22,14 +22,19 @@ import (
 	"image/color"
 	_ "image/png"
 	"log"
-	"math/rand"
+	"os"
 	"strings"
+	"time"
 
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/opentype"
 
 	"github.com/cs3238-tsuzu/flappygopher-online/internal/form"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
 	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/replay"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/sim"
+	textsoba "github.com/cs3238-tsuzu/prasoba/text"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/ebiten/v2/audio/vorbis"
@@ -41,32 +46,14 @@ import (
 	"github.com/hajimehoshi/ebiten/v2/text"
 )
 
-func init() {
-	// rand.Seed(time.Now().UnixNano())
-}
-
-func floorDiv(x, y int) int {
-	d := x / y
-	if d*y == x || x >= 0 {
-		return d
-	}
-	return d - 1
-}
-
-func floorMod(x, y int) int {
-	return x - floorDiv(x, y)*y
-}
-
 const (
-	screenWidth      = 640
-	screenHeight     = 480
-	tileSize         = 32
-	fontSize         = 32
-	smallFontSize    = fontSize / 2
-	pipeWidth        = tileSize * 2
-	pipeStartOffsetX = 8
-	pipeIntervalX    = 8
-	pipeGapY         = 5
+	screenWidth   = 640
+	screenHeight  = 480
+	tileSize      = sim.TileSize
+	fontSize      = 32
+	smallFontSize = fontSize / 2
+	pipeWidth     = sim.PipeWidth
+	pipeGapY      = sim.PipeGapY
 )
 
 var (
@@ -148,39 +135,102 @@ type Mode int
 
 const (
 	ModeForm Mode = iota
+	ModeConnect
+	ModeRoom
 	ModeTitle
 	ModeGame
 	ModeGameOver
+	ModeReplay
+	ModeSpectate
 )
 
+// options are given when the game is launched.
+type options struct {
+	// server is the WebSocket URL of the game server.
+	server string
+	// room is the code of the room to join first.
+	room string
+	// spectate watches the room instead of playing.
+	spectate bool
+	// replay is the ID of a leaderboard record whose replay is played on the title.
+	replay string
+	// logLevel is the lowest level of the logs written.
+	logLevel string
+	// logSampleUpdates is how many logs of updates one written log stands for.
+	logSampleUpdates int
+	// interpolationDelay is how far behind the other players are rendered.
+	interpolationDelay time.Duration
+}
+
 type Game struct {
 	mode Mode
 
 	me *Gopher
+	// name is the name the player entered. The server may show it differently.
+	name  string
+	world *sim.World
+	// seed is the course seed of world.
+	seed int64
+	// jumps are the ticks the player jumped at in the current run.
+	jumps []int
 
 	// Camera
 	cameraX int
 	cameraY int
 
-	// Pipes
-	pipeTileYs []int
-
 	gameoverCount int
 
 	jumpPlayerPool *AudioPool
 	hitPlayerPool  *AudioPool
 
-	client       *Client
-	otherPlayers []*Gopher
-	standingText string
-	standing     []message.Result
-	form         *form.Form
+	opts       options
+	client     GameClient
+	connecting chan connectResult
+	// outbox is the queue of the messages of the game. See send.
+	outbox     chan outgoing
+	highScores *HighScores
+	// interpolationDelay is how far behind the other players are rendered.
+	interpolationDelay time.Duration
+	otherPlayers       []*Gopher
+	standingText       string
+	standing           []message.Result
+	form               *form.Form
+
+	roomForm           *form.Form
+	newPublicRoomText  *textsoba.Text
+	newPrivateRoomText *textsoba.Text
+	roomCode           string
+	roomRequested      bool
+
+	replayText   *textsoba.Text
+	replayPlayer *replay.Player
+	// replayFetch receives the replay given by the options.
+	replayFetch chan *message.Run
+	finishedRun *message.Run
+
+	// The camera of a spectator follows the player followID, or the leader if it is empty.
+	followID   string
+	freeCamera bool
+	spectated  *Gopher
 
 	step int
 }
 
-func NewGame() *Game {
-	g := &Game{}
+// defaultServer is the game server used when none is given.
+const defaultServer = "wss://fgo.tsuzu.dev/ws"
+
+const (
+	defaultLogLevel = "info"
+	// defaultLogSampleUpdates is how many logs of updates one written log stands for.
+	defaultLogSampleUpdates = 100
+)
+
+func NewGame(opts options) *Game {
+	g := &Game{
+		opts:   opts,
+		outbox: make(chan outgoing, outboxLength),
+	}
+	go sendOutbox(g.outbox)
 	g.jumpPlayerPool = NewAudioPool(func() *audio.Player {
 		jumpPlayer, err := audio.NewPlayer(audioContext, jumpD)
 		if err != nil {
@@ -199,33 +249,223 @@ func NewGame() *Game {
 		return hitPlayer
 	})
 
-	g.form = &form.Form{}
+	g.form = &form.Form{
+		Suffix: " Gopher",
+	}
+	g.roomForm = &form.Form{
+		Label:      "ROOM CODE (EMPTY TO STAY)",
+		AllowEmpty: true,
+	}
+	g.newPublicRoomText = textsoba.NewText("NEW PUBLIC ROOM", smallArcadeFont).
+		WithColor(color.White).
+		Center(screenWidth/2, 140)
+	g.newPrivateRoomText = textsoba.NewText("NEW PRIVATE ROOM", smallArcadeFont).
+		WithColor(color.White).
+		Center(screenWidth/2, 162)
+	g.replayText = textsoba.NewText("WATCH REPLAY", smallArcadeFont).
+		WithColor(color.White).
+		Center(screenWidth/2, 180)
 	g.me = NewGopher(gopherImage, g.jumpPlayerPool, g.hitPlayerPool)
 	g.cameraX = -240
-	g.pipeTileYs = make([]int, 256)
-	for i := range g.pipeTileYs {
-		g.pipeTileYs[i] = rand.Intn(6) + 2
+	g.highScores = LoadHighScores()
+	g.interpolationDelay = opts.interpolationDelay
+
+	if opts.spectate {
+		g.mode = ModeConnect
+		g.connect()
 	}
 
-	var err error
-	g.client, err = NewClient("wss://fgo.tsuzu.dev/ws", func() *Gopher {
-		return NewGopher(gopherImage, g.jumpPlayerPool, g.hitPlayerPool)
-	})
+	if opts.replay != "" {
+		g.replayFetch = make(chan *message.Run, 1)
 
-	if err != nil {
-		panic(err)
+		go func(ch chan<- *message.Run) {
+			run, err := fetchReplay(opts.server, opts.replay)
+			if err != nil {
+				logger.Warn("failed to fetch replay", "id", opts.replay, "err", err)
+			}
+
+			ch <- run
+		}(g.replayFetch)
 	}
 
 	return g
 }
 
+// outboxLength is the number of messages of the game that can wait to be sent.
+const outboxLength = 256
+
+// outgoing is a message of the game to be sent by client.
+type outgoing struct {
+	client GameClient
+	msg    *message.Message
+}
+
+// send queues msg to be sent by the current client.
+// The messages are sent one at a time in the order they were queued, so that the server sees
+// the start, the inputs and the submission of a run in order. It never blocks the game loop.
+func (g *Game) send(msg *message.Message) {
+	select {
+	case g.outbox <- outgoing{client: g.client, msg: msg}:
+	default:
+		logger.Warn("dropped a message since too many are waiting to be sent", "kind", msg.Kind)
+	}
+}
+
+// sendOutbox sends the messages queued by send for the lifetime of the game.
+func sendOutbox(outbox <-chan outgoing) {
+	for o := range outbox {
+		if err := o.client.sendMessage(context.Background(), o.msg); err != nil {
+			logger.Debug("failed to send", "kind", o.msg.Kind, "err", err)
+		}
+	}
+}
+
+type connectResult struct {
+	client *Client
+	err    error
+}
+
+// offlineRetryInterval is the number of ticks between the attempts to connect while offline.
+const offlineRetryInterval = 30 * 60
+
+// connect connects to the server in the background.
+// Blocking in Update would stall the game loop, and deadlocks in the browser.
+func (g *Game) connect() {
+	g.connecting = make(chan connectResult, 1)
+
+	hello := message.Hello{
+		Name:      g.name,
+		Room:      g.opts.room,
+		Spectator: g.opts.spectate,
+	}
+	go func(ch chan<- connectResult) {
+		client, err := NewClient(g.opts.server, hello, g.opts.logSampleUpdates, func() *Gopher {
+			return NewGopher(gopherImage, g.jumpPlayerPool, g.hitPlayerPool)
+		})
+
+		ch <- connectResult{
+			client: client,
+			err:    err,
+		}
+	}(g.connecting)
+}
+
+// pollConnect returns the result of connect and false if it has not finished.
+func (g *Game) pollConnect() (connectResult, bool) {
+	select {
+	case res := <-g.connecting:
+		g.connecting = nil
+
+		return res, true
+	default:
+		return connectResult{}, false
+	}
+}
+
+// updateConnect waits for the first connection and goes offline if it fails.
+// Spectators keep trying instead.
+func (g *Game) updateConnect() {
+	if g.connecting == nil {
+		if g.step%spectateRetryInterval == 0 {
+			g.connect()
+		}
+
+		return
+	}
+
+	res, ok := g.pollConnect()
+	if !ok {
+		return
+	}
+
+	if res.err != nil {
+		logger.Warn("failed to connect", "err", res.err)
+		if !g.opts.spectate {
+			g.goOffline()
+		}
+
+		return
+	}
+
+	g.goOnline(res.client)
+
+	_, inRoom := res.client.Room()
+	switch {
+	case g.opts.spectate:
+		g.mode = ModeSpectate
+	case g.opts.room != "" && inRoom:
+		g.mode = ModeTitle
+		g.requestBoards()
+	default:
+		g.mode = ModeRoom
+	}
+}
+
+// updateOffline switches between the online and the offline client on the title.
+// It keeps trying to connect while offline, and goes offline when the client gave up reconnecting.
+func (g *Game) updateOffline() {
+	if _, offline := g.client.(*OfflineClient); !offline {
+		if g.client.Status() == StatusOffline {
+			g.goOffline()
+		}
+
+		return
+	}
+
+	if g.connecting == nil {
+		if g.step%offlineRetryInterval == 0 {
+			g.connect()
+		}
+
+		return
+	}
+
+	res, ok := g.pollConnect()
+	if !ok {
+		return
+	}
+	if res.err != nil {
+		logger.Warn("failed to connect", "err", res.err)
+
+		return
+	}
+
+	g.goOnline(res.client)
+	g.requestBoards()
+}
+
+// goOffline plays alone on the daily course.
+func (g *Game) goOffline() {
+	g.client = NewOfflineClient(g.name, g.highScores)
+	g.resetWorld()
+	g.mode = ModeTitle
+}
+
+// goOnline switches to client and uploads the high scores made offline.
+func (g *Game) goOnline(client *Client) {
+	g.client = client
+	g.resetWorld()
+
+	if !g.opts.spectate {
+		go uploadHighScores(client, g.highScores)
+	}
+}
+
+// resetWorld rebuilds the course from the seed of the current room.
+func (g *Game) resetWorld() {
+	room, _ := g.client.Room()
+	g.seed = room.Seed
+	g.world = sim.NewWorld(sim.NewCourse(room.Seed))
+}
+
 func (g *Game) init() {
-	g.me.reset()
+	g.resetWorld()
+	g.me.Sync(g.world.Body, false, false)
 	g.cameraX = -240
 	g.cameraY = 0
-	g.me.running = true
+	g.jumps = nil
 
-	go g.client.sendMessage(context.Background(), g.me.ComposeMessage())
+	g.send(g.me.ComposeMessage(message.KindStart))
 }
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
@@ -233,17 +473,41 @@ func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
 }
 
 func (g *Game) Update() error {
+	if g.client != nil {
+		g.me.SetName(g.client.Name())
+	}
+
 	switch g.mode {
 	case ModeForm:
-		name := g.form.Update()
+		name, ok := g.form.Update()
 
-		if name != "" {
-			g.me.name = name
-			fmt.Println(g.me.name)
-			g.mode = ModeTitle
+		if ok {
+			g.name = name
+			g.mode = ModeConnect
+			g.connect()
 		}
 		return nil
+	case ModeConnect:
+		g.updateConnect()
+		g.step++
+		return nil
+	case ModeRoom:
+		g.updateRoom()
+		g.step++
+		return nil
 	case ModeTitle:
+		g.updateOffline()
+
+		select {
+		case run := <-g.replayFetch:
+			if run != nil {
+				g.startReplay(run)
+
+				return nil
+			}
+		default:
+		}
+
 		if jump() {
 			g.mode = ModeGame
 			g.init()
@@ -253,52 +517,206 @@ func (g *Game) Update() error {
 		g.cameraX += 2
 
 		j := jump()
-		hit := g.me.Update(j, g.pipeAt)
+		tick := g.world.Body.Tick
+		hit := g.world.Step(sim.Input{Jump: j})
+		g.me.Sync(g.world.Body, j, hit)
 
+		if j {
+			g.jumps = append(g.jumps, tick)
+		}
 		if hit {
 			g.mode = ModeGameOver
 			g.gameoverCount = 30
+			g.finishedRun = g.lastRun()
 		}
 
 		if j || hit {
-			go g.client.sendMessage(context.Background(), g.me.ComposeMessage())
+			msg := g.me.ComposeMessage(message.KindInput)
+			msg.Input = &message.Input{
+				Tick: tick,
+				Jump: j,
+			}
+
+			g.send(msg)
+
+			// The run is submitted after the last input so that the server has seen the hit.
+			if hit {
+				g.send(&message.Message{
+					Kind: message.KindSubmit,
+					Run:  g.finishedRun,
+				})
+			}
 		}
 	case ModeGameOver:
 		if g.gameoverCount > 0 {
 			g.gameoverCount--
 		}
+		if g.replayText.Clicked() {
+			g.startReplay(g.finishedRun)
+
+			return nil
+		}
 		if g.gameoverCount == 0 && jump() {
 			// g.init()
 			g.mode = ModeTitle
+			g.requestBoards()
+		}
+	case ModeReplay:
+		g.updateReplay()
+		g.step++
+
+		return nil
+	case ModeSpectate:
+		g.updateSpectate()
+		if g.mode != ModeSpectate {
+			return nil
 		}
 	}
 
 	g.otherPlayers = g.client.List()
 
+	now := time.Now()
 	for i := range g.otherPlayers {
-		g.otherPlayers[i].Update(false, nil)
+		g.otherPlayers[i].Interpolate(now, g.interpolationDelay, g.world.Course.PipeAt)
 	}
 
-	standing := g.client.Standing()
-	standingText := make([]string, len(standing))
+	if g.mode == ModeTitle && g.step%boardInterval == 0 {
+		g.requestBoards()
+	}
+
+	board := g.client.Board(boards[g.boardIndex()].period)
+	standingText := make([]string, len(board))
 
-	for i := range standing {
-		standingText[i] = fmt.Sprintf("%s(%d)", standing[i].Name, standing[i].Score)
+	for i := range board {
+		standingText[i] = fmt.Sprintf("%s(%d)", board[i].Name, board[i].Score)
 	}
 	g.standingText = strings.Join(standingText, "  ")
-	g.standing = standing
+	g.standing = g.client.Standing()
 
 	g.step++
 
 	return nil
 }
 
+// boards are the leaderboards the title screen rotates between.
+var boards = []struct {
+	period, title string
+}{
+	{message.PeriodDaily, "Daily Record"},
+	{message.PeriodWeekly, "Weekly Record"},
+	{message.PeriodAllTime, "World Record"},
+}
+
+// boardInterval is the number of ticks each leaderboard is shown for.
+const boardInterval = 8 * 60
+
+func (g *Game) boardIndex() int {
+	return g.step / boardInterval % len(boards)
+}
+
+func (g *Game) requestBoards() {
+	for i := range boards {
+		go g.client.RequestBoard(context.Background(), boards[i].period)
+	}
+}
+
+func (g *Game) updateRoom() {
+	room, inRoom := g.client.Room()
+
+	if g.roomRequested {
+		if inRoom && room.Code != g.roomCode {
+			g.roomRequested = false
+			g.resetWorld()
+			g.mode = ModeTitle
+			g.requestBoards()
+		} else if g.client.RoomError() != "" {
+			g.roomRequested = false
+		}
+
+		return
+	}
+
+	if g.step%120 == 0 {
+		go g.client.RequestRooms(context.Background())
+	}
+
+	request := func(fn func(ctx context.Context) error) {
+		g.roomCode = room.Code
+		g.roomRequested = true
+
+		go fn(context.Background())
+	}
+
+	public, private := g.newPublicRoomText.Clicked(), g.newPrivateRoomText.Clicked()
+	if public || private {
+		request(func(ctx context.Context) error {
+			return g.client.Create(ctx, g.name+"'s room", public)
+		})
+
+		return
+	}
+
+	code, ok := g.roomForm.Update()
+	if !ok {
+		return
+	}
+
+	if (code == "" || code == room.Code) && inRoom {
+		g.resetWorld()
+		g.mode = ModeTitle
+		g.requestBoards()
+
+		return
+	}
+
+	if code != "" {
+		request(func(ctx context.Context) error {
+			return g.client.Join(ctx, code)
+		})
+	}
+}
+
+func (g *Game) drawRoom(screen *ebiten.Image) {
+	g.roomForm.Draw(screen)
+	g.newPublicRoomText.Draw(screen)
+	g.newPrivateRoomText.Draw(screen)
+
+	lines := []string{}
+	if room, ok := g.client.Room(); ok {
+		lines = append(lines, fmt.Sprintf("IN ROOM: %s %s", room.Code, room.Name), "")
+	}
+	if err := g.client.RoomError(); err != "" {
+		lines = append(lines, "ERROR: "+err, "")
+	}
+
+	lines = append(lines, "PUBLIC ROOMS")
+	for _, r := range g.client.Rooms() {
+		lines = append(lines, fmt.Sprintf("%s %s (%d/%d)", r.Code, r.Name, r.Players, r.MaxPlayers))
+	}
+
+	ebitenutil.DebugPrint(screen, strings.Join(lines, "\n"))
+}
+
 func (g *Game) Draw(screen *ebiten.Image) {
 	if g.mode == ModeForm {
 		g.form.Draw(screen)
 
 		return
 	}
+	if g.mode == ModeConnect {
+		texts := []string{"", "CONNECTING..."}
+		for i, l := range texts {
+			x := (screenWidth - len(l)*fontSize) / 2
+			text.Draw(screen, l, arcadeFont, x, (i+4)*fontSize, color.White)
+		}
+
+		return
+	}
+	if g.mode == ModeRoom {
+		g.drawRoom(screen)
+
+		return
+	}
 
 	screen.Fill(color.RGBA{0x80, 0xa0, 0xc0, 0xff})
 	g.drawTiles(screen)
@@ -307,15 +725,21 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		g.otherPlayers[i].Draw(screen, g.cameraX, g.cameraY)
 	}
 
-	if g.mode != ModeTitle {
+	if g.mode != ModeTitle && g.mode != ModeSpectate {
 		g.me.Draw(screen, g.cameraX, g.cameraY)
 	}
 	var texts []string
 	switch g.mode {
 	case ModeTitle:
-		texts = []string{"FLAPPY GOPHER ONLINE", "", "World Record", "", "", "PRESS SPACE KEY", "", "OR TOUCH SCREEN"}
+		texts = []string{"FLAPPY GOPHER ONLINE", "", boards[g.boardIndex()].title, "", "", "PRESS SPACE KEY", "", "OR TOUCH SCREEN"}
 	case ModeGameOver:
 		texts = []string{"", "GAME OVER!"}
+		g.replayText.Draw(screen)
+	case ModeReplay:
+		texts = []string{"REPLAY"}
+		if g.replayPlayer.Done() {
+			texts = append(texts, "", "", "", "PRESS SPACE KEY")
+		}
 	}
 
 	drawText := func(i int, l string) {
@@ -350,10 +774,19 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	}
 
 	score := g.me.Score()
+	if g.mode == ModeSpectate {
+		score = 0
+		if g.spectated != nil {
+			score = g.spectated.Score()
+		}
+	}
 	scoreStr := fmt.Sprintf("%04d", score)
 	text.Draw(screen, scoreStr, arcadeFont, screenWidth-len(scoreStr)*fontSize, fontSize, color.White)
 
-	tps := fmt.Sprintf("TPS: %0.2f", ebiten.CurrentTPS())
+	tps := fmt.Sprintf("TPS: %0.2f  %s", ebiten.CurrentTPS(), g.client.Status())
+	if room, ok := g.client.Room(); ok {
+		tps += fmt.Sprintf("  ROOM: %s", room.Code)
+	}
 	if g.mode == ModeTitle {
 		ebitenutil.DebugPrint(screen, tps)
 
@@ -361,6 +794,9 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		message := make([]string, 0, len(g.standing)+1)
 
 		message = append(message, tps+"\n")
+		if g.mode == ModeSpectate {
+			message = append(message, g.spectateLabel()+"\n")
+		}
 		for i := range g.standing {
 			message = append(message, fmt.Sprintf("%s(%d)", g.standing[i].Name, g.standing[i].Score))
 		}
@@ -369,17 +805,6 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	}
 }
 
-func (g *Game) pipeAt(tileX int) (tileY int, ok bool) {
-	if (tileX - pipeStartOffsetX) <= 0 {
-		return 0, false
-	}
-	if floorMod(tileX-pipeStartOffsetX, pipeIntervalX) != 0 {
-		return 0, false
-	}
-	idx := floorDiv(tileX-pipeStartOffsetX, pipeIntervalX)
-	return g.pipeTileYs[idx%len(g.pipeTileYs)], true
-}
-
 func (g *Game) drawTiles(screen *ebiten.Image) {
 	const (
 		nx           = screenWidth / tileSize
@@ -392,17 +817,17 @@ func (g *Game) drawTiles(screen *ebiten.Image) {
 	for i := -2; i < nx+1; i++ {
 		// ground
 		op.GeoM.Reset()
-		op.GeoM.Translate(float64(i*tileSize-floorMod(g.cameraX, tileSize)),
-			float64((ny-1)*tileSize-floorMod(g.cameraY, tileSize)))
+		op.GeoM.Translate(float64(i*tileSize-sim.FloorMod(g.cameraX, tileSize)),
+			float64((ny-1)*tileSize-sim.FloorMod(g.cameraY, tileSize)))
 		screen.DrawImage(tilesImage.SubImage(image.Rect(0, 0, tileSize, tileSize)).(*ebiten.Image), op)
 
 		// pipe
-		if tileY, ok := g.pipeAt(floorDiv(g.cameraX, tileSize) + i); ok {
+		if tileY, ok := g.world.Course.PipeAt(sim.FloorDiv(g.cameraX, tileSize) + i); ok {
 			for j := 0; j < tileY; j++ {
 				op.GeoM.Reset()
 				op.GeoM.Scale(1, -1)
-				op.GeoM.Translate(float64(i*tileSize-floorMod(g.cameraX, tileSize)),
-					float64(j*tileSize-floorMod(g.cameraY, tileSize)))
+				op.GeoM.Translate(float64(i*tileSize-sim.FloorMod(g.cameraX, tileSize)),
+					float64(j*tileSize-sim.FloorMod(g.cameraY, tileSize)))
 				op.GeoM.Translate(0, tileSize)
 				var r image.Rectangle
 				if j == tileY-1 {
@@ -414,8 +839,8 @@ func (g *Game) drawTiles(screen *ebiten.Image) {
 			}
 			for j := tileY + pipeGapY; j < screenHeight/tileSize-1; j++ {
 				op.GeoM.Reset()
-				op.GeoM.Translate(float64(i*tileSize-floorMod(g.cameraX, tileSize)),
-					float64(j*tileSize-floorMod(g.cameraY, tileSize)))
+				op.GeoM.Translate(float64(i*tileSize-sim.FloorMod(g.cameraX, tileSize)),
+					float64(j*tileSize-sim.FloorMod(g.cameraY, tileSize)))
 				var r image.Rectangle
 				if j == tileY+pipeGapY {
 					r = image.Rect(pipeTileSrcX, pipeTileSrcY, pipeTileSrcX+pipeWidth, pipeTileSrcY+tileSize)
@@ -428,11 +853,22 @@ func (g *Game) drawTiles(screen *ebiten.Image) {
 	}
 }
 
+// build identifies the client build in the hello message. It is set by the Makefile.
+var build = "dev"
+
 func main() {
 	ebiten.SetWindowSize(screenWidth, screenHeight)
 	ebiten.SetWindowTitle("Flappy Gopher Online")
 
-	if err := ebiten.RunGame(NewGame()); err != nil {
+	opts := loadOptions()
+
+	level, err := logger.ParseLevel(opts.logLevel)
+	logger.SetDefault(logger.New(os.Stderr, level, logger.FormatText))
+	if err != nil {
+		logger.Warn("invalid log level, logging at info", "err", err)
+	}
+
+	if err := ebiten.RunGame(NewGame(opts)); err != nil {
 		panic(err)
 	}
 }
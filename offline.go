@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/sim"
+)
+
+const (
+	offlineRoomCode       = "offline"
+	offlineStandingLength = 5
+)
+
+// OfflineClient lets the player fly the daily course alone while the server is unreachable.
+// It plays the part of the server: finished runs are replayed and kept in the local high-score table.
+type OfflineClient struct {
+	name   string
+	scores *HighScores
+
+	// run is the run in progress. It is nil if there is none.
+	run  *message.Run
+	lock sync.Mutex
+}
+
+var _ GameClient = &OfflineClient{}
+
+func NewOfflineClient(name string, scores *HighScores) *OfflineClient {
+	return &OfflineClient{
+		name:   name,
+		scores: scores,
+	}
+}
+
+func (c *OfflineClient) Name() string {
+	return c.name
+}
+
+func (c *OfflineClient) Room() (message.Room, bool) {
+	return message.Room{
+		Code:       offlineRoomCode,
+		Name:       "Offline",
+		Players:    1,
+		MaxPlayers: 1,
+		Seed:       sim.DailySeed(time.Now()),
+	}, true
+}
+
+func (c *OfflineClient) Rooms() []message.Room {
+	return nil
+}
+
+func (c *OfflineClient) RoomError() string {
+	return ""
+}
+
+func (c *OfflineClient) RequestRooms(ctx context.Context) error {
+	return errOffline
+}
+
+func (c *OfflineClient) Join(ctx context.Context, code string) error {
+	return errOffline
+}
+
+func (c *OfflineClient) Create(ctx context.Context, name string, public bool) error {
+	return errOffline
+}
+
+func (c *OfflineClient) Status() ConnectionStatus {
+	return StatusOffline
+}
+
+// sendMessage records the jumps of the run in progress like the server does.
+func (c *OfflineClient) sendMessage(ctx context.Context, msg *message.Message) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch msg.Kind {
+	case message.KindStart:
+		room, _ := c.Room()
+		c.run = &message.Run{
+			Seed: room.Seed,
+		}
+	case message.KindInput:
+		if c.run == nil {
+			return nil
+		}
+
+		if msg.Input.Jump {
+			c.run.Jumps = append(c.run.Jumps, msg.Input.Tick)
+		}
+		if !msg.User.Running {
+			c.finish()
+		}
+	}
+
+	return nil
+}
+
+// finish replays the run in progress and adds it to the high-score table.
+func (c *OfflineClient) finish() {
+	run := c.run
+	c.run = nil
+
+	w := sim.NewWorld(sim.NewCourse(run.Seed))
+	w.Replay(run.Jumps)
+
+	run.Score = w.Body.Score()
+	run.At = time.Now()
+	if run.Score == 0 {
+		return
+	}
+
+	c.scores.Add(c.name, *run)
+}
+
+func (c *OfflineClient) List() []*Gopher {
+	return nil
+}
+
+func (c *OfflineClient) Standing() []message.Result {
+	return c.Board(message.PeriodDaily)
+}
+
+func (c *OfflineClient) RequestBoard(ctx context.Context, period string) error {
+	return nil
+}
+
+// Board returns the local high scores of period.
+func (c *OfflineClient) Board(period string) []message.Result {
+	return c.scores.Top(periodStart(period, time.Now()), offlineStandingLength)
+}
+
+// periodStart returns the time the board of period started at now in the local time zone.
+func periodStart(period string, now time.Time) time.Time {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+
+	switch period {
+	case message.PeriodDaily:
+		return today
+	case message.PeriodWeekly:
+		return today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	default:
+		return time.Time{}
+	}
+}
+
+// uploadHighScores submits the runs played offline to the server.
+func uploadHighScores(client *Client, scores *HighScores) {
+	for _, run := range scores.Pending() {
+		ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+		err := client.sendMessage(ctx, &message.Message{
+			Kind: message.KindSubmit,
+			Run:  &run,
+		})
+		cancel()
+
+		if err != nil {
+			logger.Warn("failed to upload high score", "err", err)
+
+			return
+		}
+		scores.MarkUploaded(run)
+	}
+}
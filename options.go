@@ -0,0 +1,51 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+)
+
+// loadOptions reads the options from the command line flags and the environment.
+// The game server is given by -server or the FGO_SERVER environment variable,
+// the log level by -log-level or FGO_LOG_LEVEL, and the interpolation delay by -interpolation-delay
+// or FGO_INTERPOLATION_DELAY.
+func loadOptions() options {
+	delay := defaultInterpolationDelay
+	if d, err := time.ParseDuration(os.Getenv("FGO_INTERPOLATION_DELAY")); err == nil && d >= 0 {
+		delay = d
+	}
+
+	server := flag.String("server", os.Getenv("FGO_SERVER"), "WebSocket URL of the game server (default $FGO_SERVER or "+defaultServer+")")
+	room := flag.String("room", "", "code of the room to join")
+	spectate := flag.Bool("spectate", false, "watch the room instead of playing")
+	replay := flag.String("replay", "", "ID of a leaderboard record to watch the replay of")
+	logLevel := flag.String("log-level", os.Getenv("FGO_LOG_LEVEL"), "lowest level of the logs written: debug, info, warn or error (default $FGO_LOG_LEVEL or info)")
+	logSampleUpdates := flag.Int("log-sample-updates", defaultLogSampleUpdates, "write one of every this many debug logs of updates")
+	flag.DurationVar(&delay, "interpolation-delay", delay, "how far behind the other players are rendered (default $FGO_INTERPOLATION_DELAY or "+defaultInterpolationDelay.String()+")")
+	flag.Parse()
+
+	opts := options{
+		server:             *server,
+		room:               *room,
+		spectate:           *spectate,
+		replay:             *replay,
+		logLevel:           *logLevel,
+		logSampleUpdates:   *logSampleUpdates,
+		interpolationDelay: delay,
+	}
+	if opts.interpolationDelay < 0 {
+		opts.interpolationDelay = defaultInterpolationDelay
+	}
+	if opts.server == "" {
+		opts.server = defaultServer
+	}
+	if opts.logLevel == "" {
+		opts.logLevel = defaultLogLevel
+	}
+
+	return opts
+}
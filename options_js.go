@@ -0,0 +1,60 @@
+//go:build js
+// +build js
+
+package main
+
+import (
+	"strconv"
+	"syscall/js"
+	"time"
+)
+
+// loadOptions reads the options from the query parameters of the page.
+// The game server is given by the server parameter, or else it is the server the page is served from.
+// Pages opened from files use the default server. The log and logsample parameters set the log level
+// and the sampling of the logs of updates, and the delay parameter sets the interpolation delay, like 150ms.
+func loadOptions() options {
+	location := js.Global().Get("location")
+	params := js.Global().Get("URLSearchParams").New(location.Get("search"))
+
+	param := func(key string) string {
+		if v := params.Call("get", key); !v.IsNull() {
+			return v.String()
+		}
+
+		return ""
+	}
+
+	opts := options{
+		server:             param("server"),
+		room:               param("room"),
+		spectate:           params.Call("has", "spectate").Bool(),
+		replay:             param("replay"),
+		logLevel:           param("log"),
+		logSampleUpdates:   defaultLogSampleUpdates,
+		interpolationDelay: defaultInterpolationDelay,
+	}
+	if opts.logLevel == "" {
+		opts.logLevel = defaultLogLevel
+	}
+	if n, err := strconv.Atoi(param("logsample")); err == nil && n > 0 {
+		opts.logSampleUpdates = n
+	}
+	if d, err := time.ParseDuration(param("delay")); err == nil && d >= 0 {
+		opts.interpolationDelay = d
+	}
+	if opts.server != "" {
+		return opts
+	}
+
+	switch location.Get("protocol").String() {
+	case "https:":
+		opts.server = "wss://" + location.Get("host").String() + "/ws"
+	case "http:":
+		opts.server = "ws://" + location.Get("host").String() + "/ws"
+	default:
+		opts.server = defaultServer
+	}
+
+	return opts
+}
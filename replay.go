@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/replay"
+)
+
+// startReplay plays run back in ModeReplay.
+func (g *Game) startReplay(run *message.Run) {
+	g.replayPlayer = replay.NewPlayer(run)
+	g.world = g.replayPlayer.World
+	g.me.Sync(g.world.Body, false, false)
+	g.otherPlayers = nil
+	g.cameraX = -240
+	g.cameraY = 0
+	g.mode = ModeReplay
+}
+
+func (g *Game) updateReplay() {
+	if g.replayPlayer.Done() {
+		if jump() {
+			g.replayPlayer = nil
+			g.resetWorld()
+			g.mode = ModeTitle
+			g.requestBoards()
+		}
+
+		return
+	}
+
+	g.cameraX += 2
+
+	jumped, hit := g.replayPlayer.Step()
+	g.me.Sync(g.world.Body, jumped, hit)
+}
+
+// fetchReplay downloads the replay of the leaderboard record id from the game server.
+func fetchReplay(server, id string) (*message.Run, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	u.Path = "/api/replay"
+	u.RawQuery = url.Values{"id": {id}}.Encode()
+
+	client := &http.Client{
+		Timeout: handshakeTimeout,
+	}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to download replay: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download replay: %s", resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download replay: %w", err)
+	}
+
+	return replay.Unmarshal(b)
+}
+
+// lastRun returns the run the player has just finished.
+func (g *Game) lastRun() *message.Run {
+	return &message.Run{
+		Seed:  g.seed,
+		Jumps: g.jumps,
+		Score: g.world.Body.Score(),
+		At:    time.Now(),
+	}
+}
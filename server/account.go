@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// Accounts are the lasting identities of players. The identity token of a player is its ID
+// signed by the server, which the client keeps and presents on every visit.
+type Accounts struct {
+	key []byte
+}
+
+// NewAccounts signs identity tokens with key. A random key is made if key is empty,
+// so that the tokens are valid until the server restarts.
+func NewAccounts(key []byte) (*Accounts, error) {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Accounts{
+		key: key,
+	}, nil
+}
+
+func (a *Accounts) mac(id string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(id))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the identity token of the player id.
+func (a *Accounts) Sign(id string) string {
+	return id + "." + a.mac(id)
+}
+
+// Verify returns the player ID of token and false if the server did not sign it.
+func (a *Accounts) Verify(token string) (string, bool) {
+	idx := strings.LastIndexByte(token, '.')
+	if idx <= 0 {
+		return "", false
+	}
+
+	id := token[:idx]
+	if !hmac.Equal([]byte(token[idx+1:]), []byte(a.mac(id))) {
+		return "", false
+	}
+
+	return id, true
+}
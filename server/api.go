@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+)
+
+const defaultAPILimit = 10
+
+// OnlinePlayer is a connected player in /api/players/online.
+type OnlinePlayer struct {
+	Name    string
+	Room    string
+	Running bool
+	Score   int
+}
+
+// cors lets the pages of the allowed origins read the responses of next.
+func (h *Hub) cors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		if origin := r.Header.Get("Origin"); origin != "" && h.config.allowsOrigin(r) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Headers", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		}
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("failed to write response", "err", err)
+	}
+}
+
+// LeaderboardHandler serves the persistent leaderboard.
+// period defaults to all-time and limit to 10.
+func (h *Hub) LeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	period := query.Get("period")
+	if period == "" {
+		period = message.PeriodAllTime
+	}
+
+	limit := defaultAPILimit
+	if l := query.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > h.config.Leaderboard.Capacity {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	since, err := periodStart(period, time.Now(), h.location)
+	if err != nil {
+		http.Error(w, "invalid period", http.StatusBadRequest)
+
+		return
+	}
+
+	records, err := h.store.Top(since, limit)
+	if err != nil {
+		logger.Error("failed to load leaderboard", "err", err)
+		http.Error(w, "failed to load leaderboard", http.StatusInternalServerError)
+
+		return
+	}
+
+	// Replays are served by ReplayHandler.
+	for i := range records {
+		records[i].Replay = nil
+	}
+
+	writeJSON(w, struct {
+		Period  string
+		Records []Record
+	}{
+		Period:  period,
+		Records: records,
+	})
+}
+
+// ReplayHandler serves the replay of the record with the id in the query.
+func (h *Hub) ReplayHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	b, err := h.store.Replay(id)
+	if err == errReplayNotFound {
+		http.Error(w, "replay not found", http.StatusNotFound)
+
+		return
+	}
+	if err != nil {
+		logger.Error("failed to load replay", "err", err)
+		http.Error(w, "failed to load replay", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".fgr"))
+	w.Write(b)
+}
+
+// ProfileHandler serves the profile of the player with the id in the query.
+func (h *Hub) ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	profile, ok, err := h.profiles.Get(r.URL.Query().Get("id"))
+	if err != nil {
+		logger.Error("failed to load profile", "err", err)
+		http.Error(w, "failed to load profile", http.StatusInternalServerError)
+
+		return
+	}
+	if !ok {
+		http.Error(w, "profile not found", http.StatusNotFound)
+
+		return
+	}
+
+	writeJSON(w, profile)
+}
+
+// OnlinePlayersHandler serves the connected players. The ones in private rooms are only counted.
+func (h *Hub) OnlinePlayersHandler(w http.ResponseWriter, r *http.Request) {
+	var online int
+	h.sessionsLock.Lock()
+	players := make([]OnlinePlayer, 0, len(h.sessions))
+	for s := range h.sessions {
+		if s.spectator {
+			continue
+		}
+		online++
+
+		// Players in private rooms are counted but not listed.
+		if status, listed := s.Status(); listed {
+			players = append(players, status)
+		}
+	}
+	h.sessionsLock.Unlock()
+
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].Room != players[j].Room {
+			return players[i].Room < players[j].Room
+		}
+		return players[i].Name < players[j].Name
+	})
+
+	writeJSON(w, struct {
+		Online  int
+		Players []OnlinePlayer
+	}{
+		Online:  online,
+		Players: players,
+	})
+}
+
+func (h *Hub) RoomsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, struct {
+		Rooms []message.Room
+	}{
+		Rooms: h.publicRooms(),
+	})
+}
+
+// OriginsHandler serves the WebSocket connections from each origin.
+func (h *Hub) OriginsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, struct {
+		Origins []OriginStats
+	}{
+		Origins: h.originStats(),
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/sim"
+)
+
+// Clients send the state of their gophers with their inputs. The server simulates the gophers
+// from the inputs, so a state the physics cannot produce comes from a modified client.
+
+const (
+	// maxStepX16 is how far a gopher flies in a tick.
+	maxStepX16 = 32
+	// maxVY16 is the fastest a gopher falls or rises.
+	maxVY16 = 96
+)
+
+// violation is a reason a claimed state is implausible.
+type violation string
+
+const (
+	violationSpeed    violation = "x advanced faster than the gopher flies"
+	violationVelocity violation = "vertical velocity is out of range"
+	violationTeleport violation = "y moved further than the velocity allows"
+	violationScore    violation = "score does not match x"
+	violationRestart  violation = "running again without a new run"
+	violationTick     violation = "tick does not follow the input"
+	violationRewind   violation = "tick went backwards"
+)
+
+// checkClaim returns the violations of next, the state claimed after prev in the same run.
+// next must not be older than prev.
+func checkClaim(prev, next message.User) []violation {
+	var vs []violation
+
+	if next.VY16 < -maxVY16 || next.VY16 > maxVY16 {
+		vs = append(vs, violationVelocity)
+	}
+	body := sim.Body{X16: next.X16}
+	if next.Score != body.Score() {
+		vs = append(vs, violationScore)
+	}
+	if next.Running && !prev.Running {
+		vs = append(vs, violationRestart)
+	}
+
+	ticks := next.Tick - prev.Tick
+	if next.X16-prev.X16 > maxStepX16*ticks {
+		vs = append(vs, violationSpeed)
+	}
+	if dy := next.Y16 - prev.Y16; dy > maxVY16*ticks || -dy > maxVY16*ticks {
+		vs = append(vs, violationTeleport)
+	}
+
+	return vs
+}
+
+// CheatPolicy is what the server does about players who send implausible states.
+// Violations are counted per player until its session can no longer be resumed,
+// and per address until BanFor passes without one. Zero thresholds disable the action.
+type CheatPolicy struct {
+	// KickAfter is the number of violations of a player after which it is disconnected.
+	KickAfter int `yaml:"kick_after"`
+	// BanAfter is the number of violations from an address after which the address
+	// and the player are refused for BanFor.
+	BanAfter int           `yaml:"ban_after"`
+	BanFor   time.Duration `yaml:"ban_for"`
+}
+
+var DefaultCheatPolicy = CheatPolicy{
+	KickAfter: 10,
+	BanAfter:  30,
+	BanFor:    time.Hour,
+}
+
+type cheatAction int
+
+const (
+	cheatIgnore cheatAction = iota
+	cheatKick
+	cheatBan
+)
+
+// strikes are the violations from an address.
+type strikes struct {
+	count int
+	last  time.Time
+}
+
+// violate counts a violation of the player of s and returns what to do about it.
+func (h *Hub) violate(s *session) cheatAction {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	now := time.Now()
+	for addr, st := range h.strikes {
+		if now.Sub(st.last) > h.config.Cheat.BanFor {
+			delete(h.strikes, addr)
+		}
+	}
+
+	st := h.strikes[s.addr]
+	if st == nil {
+		st = &strikes{}
+		h.strikes[s.addr] = st
+	}
+	st.count++
+	st.last = now
+
+	violations := 0
+	for _, ident := range h.identities {
+		if ident.session == s {
+			ident.violations++
+			violations = ident.violations
+		}
+	}
+
+	switch {
+	case h.config.Cheat.BanAfter > 0 && st.count >= h.config.Cheat.BanAfter:
+		delete(h.strikes, s.addr)
+		h.bans[s.id] = now.Add(h.config.Cheat.BanFor)
+		h.bans[s.addr] = now.Add(h.config.Cheat.BanFor)
+
+		return cheatBan
+	case h.config.Cheat.KickAfter > 0 && violations >= h.config.Cheat.KickAfter:
+		return cheatKick
+	default:
+		return cheatIgnore
+	}
+}
+
+// banned reports whether any of the player IDs or addresses is banned.
+func (h *Hub) banned(keys ...string) bool {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	now := time.Now()
+	for key, until := range h.bans {
+		if now.After(until) {
+			delete(h.bans, key)
+		}
+	}
+
+	for _, key := range keys {
+		if _, ok := h.bans[key]; ok && key != "" {
+			return true
+		}
+	}
+
+	return false
+}
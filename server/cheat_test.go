@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/sim"
+)
+
+// claimOf returns the state a client claims for body.
+func claimOf(body sim.Body) message.User {
+	return message.User{
+		X16:     body.X16,
+		Y16:     body.Y16,
+		VY16:    body.VY16,
+		Running: body.Running,
+		Score:   body.Score(),
+		Tick:    body.Tick,
+	}
+}
+
+func TestCheckClaim(t *testing.T) {
+	prev := claimOf(sim.NewBody())
+
+	for _, tc := range []struct {
+		name string
+		edit func(u *message.User)
+		want []violation
+	}{
+		{name: "honest", edit: func(u *message.User) {}},
+		{name: "fast", edit: func(u *message.User) { u.X16 += maxStepX16 + 1 }, want: []violation{violationSpeed}},
+		{name: "falling too fast", edit: func(u *message.User) { u.VY16 = maxVY16 + 1 }, want: []violation{violationVelocity}},
+		{name: "teleported", edit: func(u *message.User) { u.Y16 -= maxVY16 + 1 }, want: []violation{violationTeleport}},
+		{name: "scored", edit: func(u *message.User) { u.Score++ }, want: []violation{violationScore}},
+	} {
+		b := sim.NewBody()
+		b.Step(false, nil)
+		next := claimOf(b)
+		tc.edit(&next)
+
+		if vs := checkClaim(prev, next); !reflect.DeepEqual(vs, tc.want) {
+			t.Errorf("%s: checkClaim = %v, want %v", tc.name, vs, tc.want)
+		}
+	}
+
+	stopped := prev
+	stopped.Running = false
+	if vs := checkClaim(stopped, prev); !reflect.DeepEqual(vs, []violation{violationRestart}) {
+		t.Errorf("restart: checkClaim = %v", vs)
+	}
+}
+
+func TestPlayerClaim(t *testing.T) {
+	p := newPlayer("p", "P", 1)
+	if vs := p.claim(message.User{X16: 1 << 20}, nil); vs != nil {
+		t.Errorf("a claim before the first run was checked: %v", vs)
+	}
+
+	p.start(time.Now())
+	w := sim.NewWorld(sim.NewCourse(1))
+	if vs := p.claim(claimOf(w.Body), nil); vs != nil {
+		t.Errorf("the start was refused: %v", vs)
+	}
+
+	var last message.User
+	for tick := 0; tick < 20; tick++ {
+		in := &message.Input{Tick: tick, Jump: tick%8 == 0}
+		w.Step(sim.Input{Jump: in.Jump})
+
+		last = claimOf(w.Body)
+		if vs := p.claim(last, in); vs != nil {
+			t.Fatalf("tick %d: an honest claim was refused: %v", tick, vs)
+		}
+	}
+
+	// The claim must be the state after the tick of its input.
+	if vs := p.claim(last, &message.Input{Tick: 30}); !reflect.DeepEqual(vs, []violation{violationTick}) {
+		t.Errorf("a claim for another tick returned %v", vs)
+	}
+
+	// An old input with its old state goes back in time.
+	old := claimOf(sim.NewBody())
+	old.Tick = 5
+	if vs := p.claim(old, &message.Input{Tick: 4}); !reflect.DeepEqual(vs, []violation{violationRewind}) {
+		t.Errorf("a rewound claim returned %v", vs)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the configuration of the server.
+type Config struct {
+	// Listen is the address the server listens on.
+	Listen string `yaml:"listen"`
+	// StaticDir is the directory of the game served at /. Nothing is served if it is empty.
+	StaticDir string `yaml:"static_dir"`
+	// AllowedOrigins are the host patterns of the origins of other sites whose pages may use the server,
+	// like *.example.com. The pages served by the server itself may always use it.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+
+	Leaderboard LeaderboardConfig `yaml:"leaderboard"`
+	Rooms       RoomsConfig       `yaml:"rooms"`
+	Limits      Limits            `yaml:"limits"`
+	Cheat       CheatPolicy       `yaml:"cheat"`
+	Shutdown    ShutdownConfig    `yaml:"shutdown"`
+	Log         LogConfig         `yaml:"log"`
+
+	// ProfilesPath is the file the profiles of players are kept in.
+	ProfilesPath string `yaml:"profiles_path"`
+	// NameBlocklist is the file of the words names may not contain. Nothing is blocked if it is empty.
+	NameBlocklist string `yaml:"name_blocklist"`
+	// AccountKey signs identity tokens. A random key is used if it is empty.
+	AccountKey string `yaml:"account_key"`
+}
+
+type LeaderboardConfig struct {
+	// Path is the file the persistent leaderboard is kept in.
+	Path string `yaml:"path"`
+	// Timezone is the IANA name of the location days start in. It is UTC if empty.
+	Timezone string `yaml:"timezone"`
+	// Capacity is the number of records kept for each day, each week and all time.
+	Capacity int `yaml:"capacity"`
+	// Retention is how long records are kept for the daily and weekly boards.
+	Retention time.Duration `yaml:"retention"`
+	// StandingLength is the number of results in a standing.
+	StandingLength int `yaml:"standing_length"`
+}
+
+type RoomsConfig struct {
+	// DefaultMaxPlayers is the capacity of a new room unless its creator asks for another.
+	DefaultMaxPlayers int `yaml:"default_max_players"`
+	// MaxPlayers is the largest capacity of a room, which the daily room has.
+	MaxPlayers    int `yaml:"max_players"`
+	MaxSpectators int `yaml:"max_spectators"`
+}
+
+type ShutdownConfig struct {
+	// Drain is how long the runs in progress may go on after the server is told to stop.
+	Drain time.Duration `yaml:"drain"`
+	// ReconnectAfter is how long clients are asked to wait before they come back.
+	ReconnectAfter time.Duration `yaml:"reconnect_after"`
+}
+
+type LogConfig struct {
+	// Level is the lowest level of the logs written: debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is text or json.
+	Format string `yaml:"format"`
+	// SampleUpdates writes one of every SampleUpdates debug logs of the frequent messages like inputs and updates.
+	SampleUpdates int `yaml:"sample_updates"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Listen:    ":7777",
+		StaticDir: "./dist",
+		Leaderboard: LeaderboardConfig{
+			Path:           "leaderboard.json",
+			Capacity:       leaderboardCapacity,
+			Retention:      leaderboardRetention,
+			StandingLength: standingLength,
+		},
+		Rooms: RoomsConfig{
+			DefaultMaxPlayers: defaultMaxPlayers,
+			MaxPlayers:        maxPlayersLimit,
+			MaxSpectators:     maxSpectators,
+		},
+		Limits:       DefaultLimits,
+		Cheat:        DefaultCheatPolicy,
+		Shutdown:     ShutdownConfig{Drain: shutdownDrain, ReconnectAfter: shutdownReconnectAfter},
+		Log:          LogConfig{Level: "info", Format: logger.FormatText, SampleUpdates: defaultSampleUpdates},
+		ProfilesPath: "profiles.json",
+	}
+}
+
+// defaultSampleUpdates is how many debug logs of inputs and updates one written log stands for.
+const defaultSampleUpdates = 100
+
+// Logger returns the logger writing to stderr as configured by Log.
+func (c *Config) Logger() *logger.Logger {
+	level, _ := logger.ParseLevel(c.Log.Level)
+
+	return logger.New(os.Stderr, level, c.Log.Format)
+}
+
+// stringsValue is a comma-separated list flag.
+type stringsValue []string
+
+func (v *stringsValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *stringsValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+
+	return nil
+}
+
+// bind defines a flag for every setting of c.
+func (c *Config) bind(fs *flag.FlagSet) {
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address to listen on")
+	fs.StringVar(&c.StaticDir, "static-dir", c.StaticDir, "directory of the game served at /")
+	fs.Var((*stringsValue)(&c.AllowedOrigins), "allowed-origins", "comma-separated host patterns of other sites allowed to use the server")
+
+	fs.StringVar(&c.Leaderboard.Path, "leaderboard-path", c.Leaderboard.Path, "file of the persistent leaderboard")
+	fs.StringVar(&c.Leaderboard.Timezone, "leaderboard-tz", c.Leaderboard.Timezone, "location days start in")
+	fs.IntVar(&c.Leaderboard.Capacity, "leaderboard-capacity", c.Leaderboard.Capacity, "number of records kept for each day, week and all time")
+	fs.DurationVar(&c.Leaderboard.Retention, "leaderboard-retention", c.Leaderboard.Retention, "how long daily and weekly records are kept")
+	fs.IntVar(&c.Leaderboard.StandingLength, "standing-length", c.Leaderboard.StandingLength, "number of results in a standing")
+
+	fs.IntVar(&c.Rooms.DefaultMaxPlayers, "default-max-players", c.Rooms.DefaultMaxPlayers, "capacity of a new room")
+	fs.IntVar(&c.Rooms.MaxPlayers, "max-players", c.Rooms.MaxPlayers, "largest capacity of a room")
+	fs.IntVar(&c.Rooms.MaxSpectators, "max-spectators", c.Rooms.MaxSpectators, "number of spectators in a room")
+
+	fs.Float64Var(&c.Limits.MessageRate, "message-rate", c.Limits.MessageRate, "messages per second a connection may send")
+	fs.IntVar(&c.Limits.MessageBurst, "message-burst", c.Limits.MessageBurst, "messages a connection may send at once")
+	fs.Int64Var(&c.Limits.MaxMessageSize, "max-message-size", c.Limits.MaxMessageSize, "size of the largest message in bytes")
+	fs.DurationVar(&c.Limits.IdleTimeout, "idle-timeout", c.Limits.IdleTimeout, "how long a player may send nothing, and the interval spectators are pinged at")
+	fs.IntVar(&c.Limits.MaxConnections, "max-connections", c.Limits.MaxConnections, "number of connections at once")
+
+	fs.IntVar(&c.Cheat.KickAfter, "cheat-kick-after", c.Cheat.KickAfter, "violations after which a player is kicked")
+	fs.IntVar(&c.Cheat.BanAfter, "cheat-ban-after", c.Cheat.BanAfter, "violations after which an address is banned")
+	fs.DurationVar(&c.Cheat.BanFor, "cheat-ban-for", c.Cheat.BanFor, "how long bans last")
+
+	fs.DurationVar(&c.Shutdown.Drain, "shutdown-drain", c.Shutdown.Drain, "how long runs may go on after a shutdown signal")
+	fs.DurationVar(&c.Shutdown.ReconnectAfter, "shutdown-reconnect-after", c.Shutdown.ReconnectAfter, "how long clients wait to reconnect after a shutdown")
+
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "lowest level of the logs written: debug, info, warn or error")
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, "format of the logs: text or json")
+	fs.IntVar(&c.Log.SampleUpdates, "log-sample-updates", c.Log.SampleUpdates, "write one of every this many debug logs of inputs and updates")
+
+	fs.StringVar(&c.ProfilesPath, "profiles-path", c.ProfilesPath, "file of the profiles of players")
+	fs.StringVar(&c.NameBlocklist, "name-blocklist", c.NameBlocklist, "file of the words names may not contain")
+	fs.StringVar(&c.AccountKey, "account-key", c.AccountKey, "key signing identity tokens")
+}
+
+// envPrefix starts the names of the environment variables of the server, like the FGO_SERVER of the game.
+const envPrefix = "FGO_"
+
+// envName returns the environment variable of the flag with name, like FGO_LOG_LEVEL for log-level.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// LoadConfig reads the configuration from the YAML file given by -config, the environment and args,
+// each overriding the ones before. Every flag can be set by its envName. The only exception is PORT,
+// which sets the port to listen on as hosting platforms expect.
+// It also reports whether -print-config was given.
+func LoadConfig(args []string) (*Config, bool, error) {
+	c := DefaultConfig()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(envName("config")), "YAML config file")
+	printConfig := fs.Bool("print-config", false, "print the configuration and exit")
+	c.bind(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	// The flags are parsed first to find the file, and set again after it has been read.
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	*c = *DefaultConfig()
+
+	if *path != "" {
+		b, err := ioutil.ReadFile(*path)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read config: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(b, c); err != nil {
+			return nil, false, fmt.Errorf("failed to parse config: %w", err)
+		}
+	}
+
+	if port := os.Getenv("PORT"); port != "" {
+		c.Listen = ":" + port
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		env := envName(f.Name)
+		v := os.Getenv(env)
+		if v == "" || err != nil {
+			return
+		}
+
+		if serr := f.Value.Set(v); serr != nil {
+			err = fmt.Errorf("invalid %s: %w", env, serr)
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	for name, v := range flags {
+		fs.Set(name, v)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, false, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return c, *printConfig, nil
+}
+
+// Validate reports the first setting that the server cannot run with.
+func (c *Config) Validate() error {
+	switch {
+	case c.Listen == "":
+		return errors.New("listen address is empty")
+	case c.Leaderboard.Path == "":
+		return errors.New("leaderboard path is empty")
+	case c.Leaderboard.Capacity <= 0:
+		return errors.New("leaderboard capacity must be positive")
+	case c.Leaderboard.Retention < 0:
+		return errors.New("leaderboard retention must not be negative")
+	case c.Leaderboard.StandingLength <= 0:
+		return errors.New("standing length must be positive")
+	case c.Rooms.MaxPlayers <= 0:
+		return errors.New("max players must be positive")
+	case c.Rooms.DefaultMaxPlayers <= 0 || c.Rooms.DefaultMaxPlayers > c.Rooms.MaxPlayers:
+		return errors.New("default max players must be between 1 and max players")
+	case c.Rooms.MaxSpectators < 0:
+		return errors.New("max spectators must not be negative")
+	case c.Limits.MessageRate < 0 || c.Limits.MessageBurst < 0 || c.Limits.MaxMessageSize < 0 ||
+		c.Limits.IdleTimeout < 0 || c.Limits.MaxConnections < 0:
+		return errors.New("limits must not be negative")
+	case c.Limits.MessageRate > 0 && c.Limits.MessageBurst < 1:
+		return errors.New("message burst must be positive with a message rate")
+	case c.Cheat.KickAfter < 0 || c.Cheat.BanAfter < 0 || c.Cheat.BanFor < 0:
+		return errors.New("cheat policy must not be negative")
+	case c.Shutdown.Drain < 0 || c.Shutdown.ReconnectAfter < 0:
+		return errors.New("shutdown durations must not be negative")
+	case c.ProfilesPath == "":
+		return errors.New("profiles path is empty")
+	case c.Log.Format != logger.FormatText && c.Log.Format != logger.FormatJSON:
+		return fmt.Errorf("unknown log format: %s", c.Log.Format)
+	case c.Log.SampleUpdates < 1:
+		return errors.New("log sample of updates must be positive")
+	}
+
+	if _, err := logger.ParseLevel(c.Log.Level); err != nil {
+		return err
+	}
+
+	for _, pattern := range c.AllowedOrigins {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid allowed origin %q: %w", pattern, err)
+		}
+	}
+	if _, err := time.LoadLocation(c.Leaderboard.Timezone); err != nil {
+		return fmt.Errorf("invalid leaderboard timezone: %w", err)
+	}
+
+	return nil
+}
+
+// Print writes the configuration in YAML with the account key hidden.
+func (c *Config) Print() error {
+	redacted := *c
+	if redacted.AccountKey != "" {
+		redacted.AccountKey = "REDACTED"
+	}
+
+	b, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(b)
+
+	return err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setenv sets the environment variable with key to value, or unsets it if value is empty,
+// until the test ends.
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+
+	prev, ok := os.LookupEnv(key)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("listen: \":1000\"\nlog:\n  level: warn\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name             string
+		file, port, env  string
+		args             []string
+		listen, logLevel string
+	}{
+		{name: "default", listen: DefaultConfig().Listen, logLevel: "info"},
+		{name: "file", file: path, listen: ":1000", logLevel: "warn"},
+		{name: "PORT over file", file: path, port: "2000", listen: ":2000", logLevel: "warn"},
+		{name: "env over PORT", file: path, port: "2000", env: ":3000", listen: ":3000", logLevel: "warn"},
+		{
+			name: "flag over env", file: path, port: "2000", env: ":3000",
+			args:   []string{"-listen", ":4000", "-log-level", "debug"},
+			listen: ":4000", logLevel: "debug",
+		},
+		{name: "config flag", args: []string{"-config", path}, listen: ":1000", logLevel: "warn"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setenv(t, envName("config"), tc.file)
+			setenv(t, "PORT", tc.port)
+			setenv(t, envName("listen"), tc.env)
+			setenv(t, envName("log-level"), "")
+
+			c, _, err := LoadConfig(tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Listen != tc.listen {
+				t.Errorf("Listen = %q, want %q", c.Listen, tc.listen)
+			}
+			if c.Log.Level != tc.logLevel {
+				t.Errorf("Log.Level = %q, want %q", c.Log.Level, tc.logLevel)
+			}
+		})
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	setenv(t, envName("config"), "")
+	setenv(t, "PORT", "")
+
+	setenv(t, envName("message-rate"), "fast")
+	if _, _, err := LoadConfig(nil); err == nil {
+		t.Error("an invalid environment variable was accepted")
+	}
+	setenv(t, envName("message-rate"), "")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("unknown: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadConfig([]string{"-config", path}); err == nil {
+		t.Error("an unknown setting in the file was accepted")
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/replay"
+)
+
+const (
+	// leaderboardCapacity is the number of records kept in the persistent leaderboard for each day,
+	// each week and all time.
+	leaderboardCapacity = 100
+	// leaderboardRetention is how long records are kept for the daily and weekly boards.
+	leaderboardRetention = 8 * 24 * time.Hour
+	recordIDLength       = 10
+)
+
+// Record is a finished run on a leaderboard.
+type Record struct {
+	ID    string
+	Name  string
+	Score int
+	At    time.Time
+	// PlayerID is the identity of the player. It is empty for records made before identities.
+	PlayerID string `json:",omitempty"`
+	// Replay is the run encoded by replay.Marshal.
+	Replay []byte `json:",omitempty"`
+	// RunHash is the runHash of the run. It is empty for records made before it.
+	RunHash string `json:",omitempty"`
+}
+
+var errReplayNotFound = errors.New("replay not found")
+
+// newRecord makes the record of run played by the player with the ID and the name.
+func newRecord(playerID, name string, run *message.Run) (Record, error) {
+	id, err := randomCode(recordIDLength)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return Record{
+		ID:       id,
+		PlayerID: playerID,
+		Name:     name,
+		Score:    run.Score,
+		At:       run.At,
+		Replay:   replay.Marshal(run),
+		RunHash:  runHash(run),
+	}, nil
+}
+
+// LeaderboardStore keeps the best records.
+// Implementations must be safe for concurrent use.
+type LeaderboardStore interface {
+	// Submit adds a record. It is dropped if it does not make the board.
+	// It returns errDuplicateRun if the player already has a record of the run.
+	Submit(r Record) error
+	// Top returns at most limit records made at or after since, best first.
+	Top(since time.Time, limit int) ([]Record, error)
+	// Replay returns the replay of the record with id, or errReplayNotFound.
+	Replay(id string) ([]byte, error)
+	Close() error
+}
+
+// periodStart returns the time the leaderboard of period started at now.
+// Days start at midnight in loc and weeks start on Monday.
+func periodStart(period string, now time.Time, loc *time.Location) (time.Time, error) {
+	y, m, d := now.In(loc).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, loc)
+
+	switch period {
+	case message.PeriodDaily:
+		return today, nil
+	case message.PeriodWeekly:
+		return today.AddDate(0, 0, -(int(today.Weekday())+6)%7), nil
+	case message.PeriodAllTime:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown period: %s", period)
+	}
+}
+
+// topResults returns the best n results of period in store.
+func topResults(store LeaderboardStore, period string, n int, now time.Time, loc *time.Location) ([]message.Result, error) {
+	since, err := periodStart(period, now, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := store.Top(since, n)
+	if err != nil {
+		return nil, err
+	}
+
+	standing := make([]message.Result, len(records))
+	for i := range records {
+		standing[i] = message.Result{
+			Name:  records[i].Name,
+			Score: records[i].Score,
+		}
+	}
+
+	return standing, nil
+}
+
+// board is a list of records sorted by score. It keeps the best capacity records of all time,
+// and the best capacity records of each day and week in location newer than retention.
+// It is not safe for concurrent use.
+type board struct {
+	capacity  int
+	retention time.Duration
+	location  *time.Location
+	records   []Record
+}
+
+// insert adds r and reports whether the board changed.
+func (b *board) insert(r Record, now time.Time) bool {
+	// Earlier records win ties.
+	idx := sort.Search(len(b.records), func(i int) bool {
+		return b.records[i].Score < r.Score
+	})
+	if idx >= b.capacity && now.Sub(r.At) >= b.retention {
+		return false
+	}
+
+	b.records = append(b.records, Record{})
+	copy(b.records[idx+1:], b.records[idx:])
+	b.records[idx] = r
+
+	// The board is unchanged if r misses the boards of its day and week.
+	return b.prune(now) != idx
+}
+
+// prune drops the records that are on no board and returns the index of the first one dropped,
+// or -1 if every record is kept.
+func (b *board) prune(now time.Time) int {
+	dropped := -1
+	days := make(map[time.Time]int)
+	weeks := make(map[time.Time]int)
+
+	records := b.records[:0]
+	for i, r := range b.records {
+		keep := i < b.capacity
+		if now.Sub(r.At) < b.retention {
+			day, _ := periodStart(message.PeriodDaily, r.At, b.location)
+			week, _ := periodStart(message.PeriodWeekly, r.At, b.location)
+			keep = keep || days[day] < b.capacity || weeks[week] < b.capacity
+			days[day]++
+			weeks[week]++
+		}
+
+		if keep {
+			records = append(records, r)
+		} else if dropped < 0 {
+			dropped = i
+		}
+	}
+	b.records = records
+
+	return dropped
+}
+
+func (b *board) top(since time.Time, limit int) []Record {
+	res := make([]Record, 0, limit)
+	for _, r := range b.records {
+		if len(res) >= limit {
+			break
+		}
+		if r.At.Before(since) {
+			continue
+		}
+
+		res = append(res, r)
+	}
+
+	return res
+}
+
+// has reports whether the player has a record of the run with hash.
+func (b *board) has(playerID, hash string) bool {
+	if playerID == "" || hash == "" {
+		return false
+	}
+
+	for _, r := range b.records {
+		if r.PlayerID == playerID && r.RunHash == hash {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *board) replay(id string) ([]byte, error) {
+	for _, r := range b.records {
+		if r.ID == id && len(r.Replay) != 0 {
+			return r.Replay, nil
+		}
+	}
+
+	return nil, errReplayNotFound
+}
+
+// MemoryLeaderboardStore keeps records in memory only.
+type MemoryLeaderboardStore struct {
+	lock  sync.Mutex
+	board board
+}
+
+var _ LeaderboardStore = &MemoryLeaderboardStore{}
+
+func NewMemoryLeaderboardStore(capacity int, retention time.Duration, loc *time.Location) *MemoryLeaderboardStore {
+	return &MemoryLeaderboardStore{
+		board: board{
+			capacity:  capacity,
+			retention: retention,
+			location:  loc,
+		},
+	}
+}
+
+func (s *MemoryLeaderboardStore) Submit(r Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.board.has(r.PlayerID, r.RunHash) {
+		return errDuplicateRun
+	}
+	s.board.insert(r, time.Now())
+
+	return nil
+}
+
+func (s *MemoryLeaderboardStore) Top(since time.Time, limit int) ([]Record, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.board.top(since, limit), nil
+}
+
+func (s *MemoryLeaderboardStore) Replay(id string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.board.replay(id)
+}
+
+func (s *MemoryLeaderboardStore) Close() error {
+	return nil
+}
+
+// FileLeaderboardStore keeps records in a JSON file.
+// The file is replaced atomically every time the board changes.
+type FileLeaderboardStore struct {
+	path string
+
+	lock  sync.Mutex
+	board board
+}
+
+var _ LeaderboardStore = &FileLeaderboardStore{}
+
+// NewFileLeaderboardStore loads the records in path. The file is created on the first submission.
+// Days and weeks start in loc.
+func NewFileLeaderboardStore(path string, capacity int, retention time.Duration, loc *time.Location) (*FileLeaderboardStore, error) {
+	s := &FileLeaderboardStore{
+		path: path,
+		board: board{
+			capacity:  capacity,
+			retention: retention,
+			location:  loc,
+		},
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read leaderboard: %w", err)
+	}
+
+	var records []Record
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse leaderboard: %w", err)
+	}
+
+	now := time.Now()
+	for _, r := range records {
+		s.board.insert(r, now)
+	}
+
+	return s, nil
+}
+
+func (s *FileLeaderboardStore) Submit(r Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.board.has(r.PlayerID, r.RunHash) {
+		return errDuplicateRun
+	}
+	if !s.board.insert(r, time.Now()) {
+		return nil
+	}
+
+	return s.save()
+}
+
+func (s *FileLeaderboardStore) Top(since time.Time, limit int) ([]Record, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.board.top(since, limit), nil
+}
+
+func (s *FileLeaderboardStore) Replay(id string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.board.replay(id)
+}
+
+func (s *FileLeaderboardStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.save()
+}
+
+func (s *FileLeaderboardStore) save() error {
+	b, err := json.Marshal(s.board.records)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, b)
+}
+
+// writeFileAtomic writes b to a temporary file and renames it over path.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+
+	return nil
+}
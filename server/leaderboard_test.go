@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+)
+
+// ids returns the IDs of records in order.
+func ids(records []Record) []string {
+	res := make([]string, len(records))
+	for i, r := range records {
+		res[i] = r.ID
+	}
+
+	return res
+}
+
+func TestBoardOrder(t *testing.T) {
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	b := board{capacity: 10, location: time.UTC}
+
+	for _, r := range []Record{
+		{ID: "a", Score: 3, At: now},
+		{ID: "b", Score: 5, At: now},
+		{ID: "c", Score: 3, At: now},
+		{ID: "d", Score: 1, At: now},
+		{ID: "e", Score: 5, At: now},
+	} {
+		b.insert(r, now)
+	}
+
+	// Earlier records win ties.
+	if got, want := ids(b.top(time.Time{}, 10)), []string{"b", "e", "a", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("top = %v, want %v", got, want)
+	}
+	if got, want := ids(b.top(time.Time{}, 2)), []string{"b", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("top 2 = %v, want %v", got, want)
+	}
+}
+
+func TestBoardTopSince(t *testing.T) {
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	b := board{capacity: 10, retention: leaderboardRetention, location: time.UTC}
+
+	b.insert(Record{ID: "old", Score: 9, At: now.AddDate(0, 0, -1)}, now)
+	b.insert(Record{ID: "new", Score: 1, At: now}, now)
+
+	since, err := periodStart(message.PeriodDaily, now, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(b.top(since, 10)), []string{"new"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("daily top = %v, want %v", got, want)
+	}
+}
+
+func TestBoardCapacity(t *testing.T) {
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	b := board{capacity: 2, location: time.UTC}
+
+	for i, score := range []int{1, 2, 3} {
+		if !b.insert(Record{ID: fmt.Sprint(i), Score: score, At: now}, now) {
+			t.Errorf("a record of %d did not make the board", score)
+		}
+	}
+	if b.insert(Record{ID: "low", Score: 1, At: now}, now) {
+		t.Error("a record below the board made it")
+	}
+
+	if got, want := ids(b.records), []string{"2", "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+}
+
+func TestBoardRetention(t *testing.T) {
+	// Wednesday.
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	b := board{capacity: 1, retention: leaderboardRetention, location: time.UTC}
+
+	for _, r := range []Record{
+		{ID: "best", Score: 9, At: now.AddDate(0, 0, -10)},
+		// Last week, past the retention.
+		{ID: "expired", Score: 5, At: now.AddDate(0, 0, -9)},
+		// Last week.
+		{ID: "sunday", Score: 4, At: now.AddDate(0, 0, -3)},
+		{ID: "monday", Score: 3, At: now.AddDate(0, 0, -2)},
+		{ID: "today", Score: 2, At: now},
+	} {
+		b.insert(r, now)
+	}
+	// Best of neither its day nor its week.
+	if b.insert(Record{ID: "worse", Score: 1, At: now}, now) {
+		t.Error("a record on no board made it")
+	}
+
+	if got, want := ids(b.records), []string{"best", "sunday", "monday", "today"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+}
+
+func TestFileLeaderboardStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leaderboard.json")
+
+	s, err := NewFileLeaderboardStore(path, 10, leaderboardRetention, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	records := []Record{
+		{ID: "a", Name: "A", Score: 2, At: now, PlayerID: "p", Replay: []byte{1, 2}, RunHash: "x"},
+		{ID: "b", Name: "B", Score: 3, At: now, PlayerID: "q"},
+	}
+	for _, r := range records {
+		if err := s.Submit(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Submit(Record{ID: "c", Score: 2, At: now, PlayerID: "p", RunHash: "x"}); err != errDuplicateRun {
+		t.Errorf("submitting a run twice returned %v, want errDuplicateRun", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewFileLeaderboardStore(path, 10, leaderboardRetention, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	top, err := s.Top(time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Record{records[1], records[0]}; !reflect.DeepEqual(top, want) {
+		t.Errorf("reloaded %+v, want %+v", top, want)
+	}
+
+	if b, err := s.Replay("a"); err != nil || !reflect.DeepEqual(b, records[0].Replay) {
+		t.Errorf("Replay(a) = %v, %v", b, err)
+	}
+	if _, err := s.Replay("b"); err != errReplayNotFound {
+		t.Errorf("Replay of a record without one returned %v, want errReplayNotFound", err)
+	}
+}
+
+func TestFileLeaderboardStoreConcurrentSubmit(t *testing.T) {
+	s, err := NewFileLeaderboardStore(filepath.Join(t.TempDir(), "leaderboard.json"), 10, leaderboardRetention, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				r := Record{ID: fmt.Sprintf("%d-%d", i, j), Score: j, At: now}
+				if err := s.Submit(r); err != nil {
+					t.Error(err)
+				}
+				if _, err := s.Top(time.Time{}, 10); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	top, err := s.Top(time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range top {
+		if r.Score != 49-i/8 {
+			t.Errorf("record %d scored %d, want %d", i, r.Score, 49-i/8)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"time"
+)
+
+// Limits protect the server and the other players from misbehaving clients.
+// Zero values disable the limits.
+type Limits struct {
+	// MessageRate is the number of messages per second a connection may send on average.
+	// MessageBurst is the number it may send at once.
+	MessageRate  float64 `yaml:"message_rate"`
+	MessageBurst int     `yaml:"message_burst"`
+	// MaxMessageSize is the size of the largest frame the server reads.
+	MaxMessageSize int64 `yaml:"max_message_size"`
+	// IdleTimeout is how long a player may send nothing. Spectators are pinged at this interval instead.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// MaxConnections is the number of connections the server accepts at once.
+	MaxConnections int `yaml:"max_connections"`
+}
+
+// pongTimeout is how long the server waits for the answer to a ping.
+const pongTimeout = 30 * time.Second
+
+var DefaultLimits = Limits{
+	MessageRate:    20,
+	MessageBurst:   40,
+	MaxMessageSize: 64 << 10,
+	IdleTimeout:    10 * time.Minute,
+	MaxConnections: 1000,
+}
+
+// tokenBucket allows rate events per second on average and burst events at once.
+// It is not safe for concurrent use.
+type tokenBucket struct {
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+}
+
+// newTokenBucket returns a full bucket. A bucket with no rate allows everything.
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// take reports whether an event is allowed at now and takes a token for it.
+func (b *tokenBucket) take(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// connect reserves a connection and reports whether the server had room for it.
+func (h *Hub) connect() bool {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	if h.config.Limits.MaxConnections > 0 && h.connections >= h.config.Limits.MaxConnections {
+		return false
+	}
+	h.connections++
+
+	return true
+}
+
+func (h *Hub) disconnect() {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	h.connections--
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	b := newTokenBucket(2, 3, now)
+
+	for i := 0; i < 3; i++ {
+		if !b.take(now) {
+			t.Fatalf("event %d of the burst was refused", i)
+		}
+	}
+	if b.take(now) {
+		t.Error("an event past the burst was allowed")
+	}
+
+	// Half a second refills a token.
+	now = now.Add(500 * time.Millisecond)
+	if !b.take(now) {
+		t.Error("an event after a refill was refused")
+	}
+	if b.take(now) {
+		t.Error("a second event after a single refill was allowed")
+	}
+
+	// The bucket does not hold more than the burst.
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		if !b.take(now) {
+			t.Fatalf("event %d after a long wait was refused", i)
+		}
+	}
+	if b.take(now) {
+		t.Error("the bucket refilled past the burst")
+	}
+}
+
+func TestTokenBucketNoRate(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(0, 0, now)
+
+	for i := 0; i < 100; i++ {
+		if !b.take(now) {
+			t.Fatal("a bucket with no rate refused an event")
+		}
+	}
+}
@@ -2,124 +2,524 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"reflect"
+	"os/signal"
 	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/grafov/bcast"
 
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
 	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
 	"nhooyr.io/websocket"
-	"nhooyr.io/websocket/wsjson"
 )
 
 type Hub struct {
-	group *bcast.Group
+	rooms     map[string]*Room
+	roomsLock sync.Mutex
+
+	sessions   map[*session]struct{}
+	identities map[string]*identity
+	// bans maps banned player IDs and addresses to when the bans end.
+	bans map[string]time.Time
+	// shuttingDown is set when Shutdown is called. No sessions are registered after that.
+	shuttingDown bool
+	// strikes are the recent violations from each address.
+	strikes map[string]*strikes
+	// runs are the runs submitted recently, keyed by the player ID and runHash, with when they were played.
+	runs map[string]time.Time
+	// connections is the number of open WebSocket connections.
+	connections int
+	// origins are the WebSocket connections from each origin.
+	origins      map[string]*OriginStats
+	sessionsLock sync.Mutex
+
+	config   *Config
+	store    LeaderboardStore
+	profiles ProfileStore
+	accounts *Accounts
+	location *time.Location
+	names    *NameFilter
 }
 
-func (h *Hub) standingWorker() {
-	member := h.group.Join()
-	defer member.Close()
+var (
+	errRoomNotFound = errors.New("room not found")
+	errRoomFull     = errors.New("room is full")
+	// errConnectedElsewhere is returned for a player that is already connected from another tab.
+	errConnectedElsewhere = errors.New("the player is already connected from another tab")
+)
+
+// NewHub opens the stores, the name filter and the daily room given by config.
+func NewHub(config *Config) (*Hub, error) {
+	location, err := time.LoadLocation(config.Leaderboard.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := LoadNameFilter(config.NameBlocklist)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.AccountKey == "" {
+		logger.Warn("no account key is set, identity tokens are valid until the server restarts")
+	}
+
+	accounts, err := NewAccounts([]byte(config.AccountKey))
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewFileLeaderboardStore(config.Leaderboard.Path, config.Leaderboard.Capacity, config.Leaderboard.Retention, location)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := NewFileProfileStore(config.ProfilesPath)
+	if err != nil {
+		store.Close()
+
+		return nil, err
+	}
+
+	h := &Hub{
+		rooms:      make(map[string]*Room),
+		sessions:   make(map[*session]struct{}),
+		identities: make(map[string]*identity),
+		bans:       make(map[string]time.Time),
+		strikes:    make(map[string]*strikes),
+		runs:       make(map[string]time.Time),
+		origins:    make(map[string]*OriginStats),
+		config:     config,
+		store:      store,
+		profiles:   profiles,
+		accounts:   accounts,
+		location:   location,
+		names:      names,
+	}
+
+	daily := newDailyRoom(store, location, config)
+	h.rooms[daily.code] = daily
+
+	return h, nil
+}
+
+// board returns the standing of the persistent leaderboard in period.
+func (h *Hub) board(period string) ([]message.Result, error) {
+	return topResults(h.store, period, h.config.Leaderboard.StandingLength, time.Now(), h.location)
+}
+
+// enter reserves a place in the room with the code.
+// Spectators do not take the places of players.
+func (h *Hub) enter(code string, spectator bool) (*Room, message.Room, error) {
+	h.roomsLock.Lock()
+	defer h.roomsLock.Unlock()
+
+	r, ok := h.rooms[strings.ToLower(code)]
+	if !ok {
+		return nil, message.Room{}, errRoomNotFound
+	}
+
+	if spectator {
+		if r.spectators >= h.config.Rooms.MaxSpectators {
+			return nil, message.Room{}, errRoomFull
+		}
+		r.spectators++
+
+		return r, r.info(r.players), nil
+	}
+
+	if r.players >= r.maxPlayers {
+		return nil, message.Room{}, errRoomFull
+	}
+	r.players++
 
-	const maxLength = 5
-	standing := make([]message.Result, 0, maxLength)
+	return r, r.info(r.players), nil
+}
 
+// create opens a new room and reserves a place in it.
+func (h *Hub) create(name string, public bool, maxPlayers int) (*Room, message.Room, error) {
+	if maxPlayers <= 0 {
+		maxPlayers = h.config.Rooms.DefaultMaxPlayers
+	}
+	if maxPlayers > h.config.Rooms.MaxPlayers {
+		maxPlayers = h.config.Rooms.MaxPlayers
+	}
+	name = h.names.CleanRoomName(name)
+
+	seed, err := randomSeed()
+	if err != nil {
+		return nil, message.Room{}, err
+	}
+
+	h.roomsLock.Lock()
+	defer h.roomsLock.Unlock()
+
+	var code string
 	for {
-		select {
-		case m, ok := <-member.Read:
-			if !ok {
-				return
-			}
+		code, err = randomCode(roomCodeLength)
+		if err != nil {
+			return nil, message.Room{}, err
+		}
+		if _, ok := h.rooms[code]; !ok {
+			break
+		}
+	}
 
-			msg := m.(*message.Message)
-			log.Println(msg)
+	r := newRoom(code, name, public, maxPlayers, seed, h.config)
+	r.players++
+	h.rooms[code] = r
 
-			if msg.Kind == message.KindUpdate {
-				if msg.User.Running || msg.User.Score == 0 {
-					continue
-				}
+	return r, r.info(r.players), nil
+}
 
-				tmp := make([]message.Result, len(standing), len(standing)+1)
-				copy(tmp, standing)
+// leave releases a place and the name of a player in the room.
+// Rooms other than the daily one are closed when they have been empty for resumeTimeout,
+// so that a player who lost the connection can resume into the room.
+func (h *Hub) leave(r *Room, spectator bool, name string) {
+	h.roomsLock.Lock()
+	defer h.roomsLock.Unlock()
 
-				tmp = append(tmp, message.Result{
-					Name:  msg.User.Name,
-					Score: msg.User.Score,
-				})
+	delete(r.names, strings.ToLower(name))
 
-				sort.SliceStable(tmp, func(i, j int) bool {
-					return tmp[i].Score > tmp[j].Score
-				})
+	if spectator {
+		r.spectators--
+	} else {
+		r.players--
+	}
+	if r.players > 0 || r.spectators > 0 || r.daily {
+		return
+	}
 
-				if len(tmp) > maxLength {
-					tmp = tmp[:maxLength]
-				}
+	r.emptiedAt = time.Now()
+	time.AfterFunc(resumeTimeout, func() {
+		h.closeEmpty(r)
+	})
+}
 
-				if !reflect.DeepEqual(standing, tmp) {
-					if len(standing) < len(tmp) {
-						standing = append(standing, make([]message.Result, len(tmp)-len(standing))...)
-					}
-					copy(standing, tmp)
+// closeEmpty closes r if it has been empty for resumeTimeout.
+func (h *Hub) closeEmpty(r *Room) {
+	h.roomsLock.Lock()
+	defer h.roomsLock.Unlock()
 
-					member.Send(&message.Message{
-						Kind:     message.KindStanding,
-						Standing: tmp,
-					})
-				}
-			} else if msg.Kind == message.KindJoin {
-				tmp := make([]message.Result, len(standing), len(standing)+1)
-				copy(tmp, standing)
+	if r.players > 0 || r.spectators > 0 || time.Since(r.emptiedAt) < resumeTimeout || h.rooms[r.code] != r {
+		return
+	}
 
-				member.Send(&message.Message{
-					Kind:     message.KindStanding,
-					Standing: tmp,
-				})
+	delete(h.rooms, r.code)
+	r.close()
+}
+
+func (h *Hub) publicRooms() []message.Room {
+	h.roomsLock.Lock()
+	rooms := make([]message.Room, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		if r.public {
+			rooms = append(rooms, r.info(r.players))
+		}
+	}
+	h.roomsLock.Unlock()
+
+	sort.Slice(rooms, func(i, j int) bool {
+		if rooms[i].Players != rooms[j].Players {
+			return rooms[i].Players > rooms[j].Players
+		}
+		return rooms[i].Code < rooms[j].Code
+	})
+
+	return rooms
+}
+
+const (
+	// helloTimeout is how long the server waits for the hello of a new connection.
+	helloTimeout = 10 * time.Second
+	// resumeTimeout is how long the player of a closed connection can be resumed.
+	resumeTimeout = time.Minute
+)
+
+// identity is a player that can be resumed by its session token.
+type identity struct {
+	id string
+	// session is the connection of the player. It is nil after the connection is closed.
+	session *session
+	expires time.Time
+	// violations is the number of implausible states the player has sent.
+	violations int
+}
+
+// resume returns the player of token for s and the token to resume it later.
+// Without a valid token, the player with playerID is resumed, or issued under a new token, or a new ID
+// if playerID is empty. It returns errConnectedElsewhere if a connection holds the player with playerID,
+// since the ID of a player tells it apart from the others in the room.
+// A connection still holding the player is closed first, so that its leave is broadcast before s joins.
+func (h *Hub) resume(ctx context.Context, s *session, token, playerID string) (string, string, error) {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	now := time.Now()
+	for t, ident := range h.identities {
+		if ident.session == nil && now.After(ident.expires) {
+			delete(h.identities, t)
+		}
+	}
+
+	ident, ok := h.identities[token]
+	if !ok && playerID != "" {
+		for t, other := range h.identities {
+			if other.id != playerID {
+				continue
+			}
+			if other.session != nil {
+				return "", "", errConnectedElsewhere
 			}
+
+			ident, token, ok = other, t, true
 		}
 	}
+	if !ok {
+		token, err := randomToken()
+		if err != nil {
+			return "", "", err
+		}
+
+		if playerID == "" {
+			playerID = uuid.New().String()
+		}
+		h.identities[token] = &identity{
+			id:      playerID,
+			session: s,
+		}
 
+		return h.identities[token].id, token, nil
+	}
+
+	if old := ident.session; old != nil {
+		h.sessionsLock.Unlock()
+		old.cancel()
+		select {
+		case <-old.done:
+		case <-ctx.Done():
+		}
+		h.sessionsLock.Lock()
+
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		if ident.session != nil {
+			return "", "", errors.New("session token is in use")
+		}
+	}
+	ident.session = s
+
+	return ident.id, token, nil
 }
 
-func (h *Hub) HandleGameConnection(ctx context.Context, conn *websocket.Conn) {
-	ctx, cancel := context.WithCancel(ctx)
+// release lets the player of s be resumed until resumeTimeout passes.
+func (h *Hub) release(s *session) {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	for _, ident := range h.identities {
+		if ident.session == s {
+			ident.session = nil
+			ident.expires = time.Now().Add(resumeTimeout)
+		}
+	}
+}
+
+func randomToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b[:]), nil
+}
+
+// capabilities are the capabilities the server supports.
+var capabilities = []string{
+	message.CapabilityRooms,
+	message.CapabilityBoards,
+	message.CapabilitySpectate,
+}
+
+// handshake waits for the hello of the client and welcomes it into the room it asked for.
+// Clients speaking another protocol version are disconnected with message.CloseIncompatible.
+func (h *Hub) handshake(ctx context.Context, s *session) error {
+	helloCtx, cancel := context.WithTimeout(ctx, helloTimeout)
 	defer cancel()
-	member := h.group.Join()
-	defer member.Close()
-	id := uuid.New().String()
-	log.Println(id, "joined")
-	defer log.Println(id, "left")
-
-	member.Send(&message.Message{
-		Kind: message.KindJoin,
-	})
 
-	go func() {
-		defer cancel()
-		for {
-			select {
-			case msg, ok := <-member.Read:
-				if !ok {
-					return
-				}
+	var msg message.Message
+	if err := s.read(helloCtx, &msg); err != nil {
+		return err
+	}
 
-				m := msg.(*message.Message)
+	if !msg.Validate() || msg.Kind != message.KindHello {
+		metrics.reject(rejectInvalid)
+		s.conn.Close(websocket.StatusPolicyViolation, "expected hello")
 
-				if m.Kind == message.KindJoin {
-					continue
-				}
+		return fmt.Errorf("unexpected message kind: %s", msg.Kind)
+	}
 
-				if err := wsjson.Write(ctx, conn, msg); err != nil {
-					return
-				}
-			case <-ctx.Done():
-				return
+	hello := msg.Hello
+	if hello.Version != message.ProtocolVersion {
+		reason := fmt.Sprintf("protocol version %d is not supported, the server speaks %d", hello.Version, message.ProtocolVersion)
+		s.conn.Close(websocket.StatusCode(message.CloseIncompatible), reason)
+
+		return errors.New(reason)
+	}
+
+	// Players without a valid identity token are new.
+	playerID, _ := h.accounts.Verify(hello.Identity)
+
+	id, token, err := h.resume(helloCtx, s, hello.Token, playerID)
+	if err == errConnectedElsewhere {
+		s.conn.Close(websocket.StatusCode(message.CloseConnectedElsewhere), err.Error())
+
+		return err
+	}
+	if err != nil {
+		s.conn.Close(websocket.StatusTryAgainLater, "failed to resume the session")
+
+		return fmt.Errorf("failed to resume session: %w", err)
+	}
+	resumed := hello.Token != "" && token == hello.Token
+
+	if h.banned(id) {
+		s.conn.Close(websocket.StatusPolicyViolation, "banned")
+
+		return errors.New("banned player tried to resume")
+	}
+
+	s.id = id
+	s.name = h.names.Clean(hello.Name)
+	s.spectator = hello.Spectator
+	s.setLogger()
+
+	if err := h.profiles.Seen(s.id, s.name, time.Now()); err != nil {
+		s.log.Error("failed to update profile", "err", err)
+	}
+
+	welcome := &message.Welcome{
+		PlayerID:   s.id,
+		ServerTime: time.Now(),
+		Token:      token,
+		Identity:   h.accounts.Sign(s.id),
+	}
+	for _, c := range hello.Capabilities {
+		for _, supported := range capabilities {
+			if c == supported {
+				welcome.Capabilities = append(welcome.Capabilities, c)
 			}
 		}
+	}
+
+	code := hello.Room
+	if code == "" {
+		code = dailyRoomCode
+	}
+
+	reply := &message.Message{
+		Kind:    message.KindWelcome,
+		Welcome: welcome,
+	}
+
+	var name string
+	r, info, err := h.enter(code, s.spectator)
+	if err == nil {
+		if !s.spectator {
+			name = h.claimName(r, s.name)
+		}
+
+		welcome.Room = &info
+		welcome.Seed = info.Seed
+		welcome.Name = name
+	} else {
+		reply.Error = err.Error()
+	}
+
+	if err := s.write(ctx, reply); err != nil {
+		if r != nil {
+			h.leave(r, s.spectator, name)
+		}
+
+		return err
+	}
+
+	if r != nil {
+		s.enter(ctx, r, info, name)
+	}
+	s.log.Info("said hello", "build", hello.Build, "resumed", resumed, "spectator", s.spectator)
+
+	return nil
+}
+
+// HandleGameConnection serves the client connected from addr.
+func (h *Hub) HandleGameConnection(ctx context.Context, conn *websocket.Conn, addr string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s := &session{
+		hub:    h,
+		conn:   conn,
+		addr:   addr,
+		codec:  message.CodecFor(conn.Subprotocol()),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.setLogger()
+
+	defer close(s.done)
+	defer h.release(s)
+	defer s.leave()
+
+	if err := h.handshake(ctx, s); err != nil {
+		s.log.Info("handshake failed", "err", err)
+
+		return
+	}
+
+	// Sessions are registered after the handshake so that Shutdown only notifies welcomed clients.
+	if !h.register(s) {
+		conn.Close(websocket.StatusServiceRestart, "server is shutting down")
+
+		return
+	}
+	defer h.unregister(s)
+
+	s.log.Info("joined")
+	defer func() {
+		s.log.Info("left")
 	}()
 
+	// Closing the connection makes the read below fail.
+	// Spectators send nothing while they watch, so they are kept as long as they answer pings.
+	var idle *time.Timer
+	switch {
+	case h.config.Limits.IdleTimeout <= 0:
+	case s.spectator:
+		go s.keepAlive(ctx, h.config.Limits.IdleTimeout)
+	default:
+		idle = time.AfterFunc(h.config.Limits.IdleTimeout, func() {
+			s.log.Info("closed an idle connection")
+			conn.Close(websocket.StatusCode(message.CloseIdle), "idle for too long")
+		})
+		defer idle.Stop()
+	}
+
+	bucket := newTokenBucket(h.config.Limits.MessageRate, h.config.Limits.MessageBurst, time.Now())
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -128,70 +528,316 @@ func (h *Hub) HandleGameConnection(ctx context.Context, conn *websocket.Conn) {
 		}
 
 		var msg message.Message
-		err := wsjson.Read(ctx, conn, &msg)
+		err := s.read(ctx, &msg)
 		if err != nil {
 			break
 		}
 
-		if !msg.Validate() || msg.Kind != message.KindUpdate {
+		if idle != nil {
+			idle.Reset(h.config.Limits.IdleTimeout)
+		}
+		if !bucket.take(time.Now()) {
+			metrics.reject(rejectRateLimited)
+			s.log.Warn("sent messages too fast")
+			conn.Close(websocket.StatusCode(message.CloseRateLimited), "too many messages")
+
+			return
+		}
+
+		if !msg.Validate() {
+			metrics.reject(rejectInvalid)
+			s.log.Debug("received an invalid message", "kind", msg.Kind)
+
 			continue
 		}
-		msg.User.ID = id
 
-		member.Send(&msg)
-	}
+		if msg.Kind == message.KindInput {
+			s.updates.Debug("received", "kind", msg.Kind)
+		} else {
+			s.log.Debug("received", "kind", msg.Kind)
+		}
 
-	member.Send(&message.Message{
-		Kind: message.KindLeave,
-		User: message.User{
-			ID: id,
-		},
-	})
+		switch msg.Kind {
+		case message.KindRooms:
+			err = s.write(ctx, &message.Message{
+				Kind:  message.KindRooms,
+				Rooms: h.publicRooms(),
+			})
+		case message.KindStanding:
+			var standing []message.Result
+			if msg.Period != "" {
+				standing, err = h.board(msg.Period)
+			} else if s.room != nil {
+				standing = s.room.standing()
+			}
+			if err != nil {
+				s.log.Error("failed to load leaderboard", "period", msg.Period, "err", err)
+			}
+
+			err = s.write(ctx, &message.Message{
+				Kind:     message.KindStanding,
+				Standing: standing,
+				Period:   msg.Period,
+			})
+		case message.KindJoin:
+			var r *Room
+			var info message.Room
+			r, info, err = h.enter(msg.Room.Code, s.spectator)
+			if err == nil {
+				err = s.join(ctx, r, info)
+			} else {
+				err = s.write(ctx, &message.Message{
+					Kind:  message.KindError,
+					Error: err.Error(),
+				})
+			}
+		case message.KindCreate:
+			if s.spectator {
+				err = s.write(ctx, &message.Message{
+					Kind:  message.KindError,
+					Error: "spectators cannot create rooms",
+				})
+
+				break
+			}
+
+			var r *Room
+			var info message.Room
+			r, info, err = h.create(msg.Room.Name, msg.Room.Public, msg.Room.MaxPlayers)
+			if err == nil {
+				err = s.join(ctx, r, info)
+			} else {
+				s.log.Error("failed to create room", "err", err)
+				err = s.write(ctx, &message.Message{
+					Kind:  message.KindError,
+					Error: "failed to create room",
+				})
+			}
+		case message.KindSubmit:
+			if s.spectator {
+				continue
+			}
+
+			// Shutdown keeps the connection open while the player is playing,
+			// so the run is stored before it is marked as finished.
+			h.submit(s, msg.Run)
+			s.setPlaying(false)
+		case message.KindStart, message.KindInput:
+			if s.room == nil || s.spectator {
+				continue
+			}
+
+			if msg.Kind == message.KindStart {
+				s.player.start(time.Now())
+				s.setPlaying(!h.closing())
+			}
+
+			var in *message.Input
+			if msg.Kind == message.KindInput {
+				in = msg.Input
+			}
+			if vs := s.player.claim(msg.User, in); len(vs) != 0 {
+				metrics.reject(rejectImplausible)
+				s.log.Warn("sent an implausible state", "violations", fmt.Sprint(vs))
+
+				switch h.violate(s) {
+				case cheatBan:
+					s.log.Warn("banned the player and the address")
+					s.conn.Close(websocket.StatusPolicyViolation, "banned")
+
+					return
+				case cheatKick:
+					s.log.Warn("kicked the player")
+					s.conn.Close(websocket.StatusPolicyViolation, "implausible updates")
+
+					return
+				}
+
+				continue
+			}
+
+			if msg.Kind == message.KindInput && !s.player.apply(*msg.Input, time.Now()) {
+				continue
+			}
+
+			user := s.player.user()
+			s.setStatus(user)
+
+			s.member.Send(&message.Message{
+				Kind: message.KindUpdate,
+				User: user,
+			})
+		}
+
+		if err != nil {
+			break
+		}
+	}
 }
 
 func (h *Hub) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
-	c, err := websocket.Accept(w, r, nil)
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	if h.banned(addr) {
+		http.Error(w, "banned", http.StatusForbidden)
+
+		return
+	}
+
+	origin := r.Header.Get("Origin")
+	if !h.config.allowsOrigin(r) {
+		logger.Info("refused a connection", "addr", addr, "origin", origin)
+		h.countOrigin(origin, false)
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+
+		return
+	}
+
+	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		Subprotocols:   message.Subprotocols(),
+		OriginPatterns: h.config.AllowedOrigins,
+	})
 	if err != nil {
 		return
 	}
 	defer c.Close(websocket.StatusInternalError, "the sky is falling")
 
-	h.HandleGameConnection(r.Context(), c)
+	if !h.connect() {
+		c.Close(websocket.StatusTryAgainLater, "server is full")
+
+		return
+	}
+	defer h.disconnect()
+
+	h.countOrigin(origin, true)
+	defer h.uncountOrigin(origin)
+
+	if h.config.Limits.MaxMessageSize > 0 {
+		c.SetReadLimit(h.config.Limits.MaxMessageSize)
+	}
+
+	h.HandleGameConnection(r.Context(), c, addr)
 
 	c.Close(websocket.StatusNormalClosure, "")
 }
 
-func main() {
-	group := bcast.NewGroup()
-	go group.Broadcast(0)
+// submit stores a run of the player of s.
+// Runs are submitted at the end of a run in a room, and runs played offline after connecting
+// before any run in the room.
+func (h *Hub) submit(s *session, run *message.Run) {
+	if s.room == nil || !s.player.played() {
+		if err := h.submitOfflineRun(s.id, s.name, run); err != nil {
+			metrics.reject(rejectRun)
+			s.log.Warn("rejected offline run", "err", err)
+		}
+
+		return
+	}
 
-	hub := &Hub{
-		group: group,
+	if err := s.player.submit(run); err != nil {
+		metrics.reject(rejectRun)
+		s.log.Warn("rejected run", "err", err)
+
+		return
 	}
 
-	go hub.standingWorker()
+	verified := *run
+	verified.At = time.Now()
+	if !h.claimRun(s.id, &verified) {
+		metrics.reject(rejectRun)
+		s.log.Warn("rejected run", "err", errDuplicateRun)
 
+		return
+	}
+	if err := h.profiles.AddRun(s.id, verified.Score, verified.At); err != nil {
+		s.log.Error("failed to update profile", "err", err)
+	}
+
+	user := s.player.user()
+	if err := s.room.submit(user, &verified); err == errDuplicateRun {
+		s.log.Warn("rejected run", "err", err)
+	} else if err != nil {
+		s.log.Error("failed to submit record", "err", err)
+	}
+
+	s.member.Send(&message.Message{
+		Kind: message.KindSubmit,
+		User: user,
+		Run:  &verified,
+	})
+}
+
+// Handler serves the game, the API, the metrics and the static files of the server.
+func (h *Hub) Handler() http.Handler {
 	mux := http.NewServeMux()
-	mux.Handle("/", http.FileServer(http.Dir("./dist")))
-	mux.HandleFunc("/ws", hub.WebSocketHandler)
-
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Headers", "*")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+	if h.config.StaticDir != "" {
+		mux.Handle("/", http.FileServer(http.Dir(h.config.StaticDir)))
+	}
+	mux.HandleFunc("/ws", h.WebSocketHandler)
+	mux.HandleFunc("/api/leaderboard", h.cors(h.LeaderboardHandler))
+	mux.HandleFunc("/api/players/online", h.cors(h.OnlinePlayersHandler))
+	mux.HandleFunc("/api/rooms", h.cors(h.RoomsHandler))
+	mux.HandleFunc("/api/replay", h.cors(h.ReplayHandler))
+	mux.HandleFunc("/api/profile", h.cors(h.ProfileHandler))
+	mux.HandleFunc("/api/origins", h.OriginsHandler)
+	mux.HandleFunc("/metrics", h.MetricsHandler)
+
+	return mux
+}
+
+func main() {
+	config, printConfig, err := LoadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger.SetDefault(config.Logger())
+
+	if printConfig {
+		if err := config.Print(); err != nil {
+			log.Fatal(err)
 		}
 
-		mux.ServeHTTP(w, r)
-	})
+		return
+	}
 
-	port := os.Getenv("PORT")
+	hub, err := NewHub(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := &http.Server{
+		Addr:    config.Listen,
+		Handler: hub.Handler(),
+	}
 
-	if port == "" {
-		port = "7777"
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	logger.Info("shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Shutdown.Drain)
+	defer cancel()
+
+	// WebSocket connections are hijacked, so the server only stops accepting new ones.
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("failed to shut down the HTTP server", "err", err)
+	}
+	if err := hub.Shutdown(ctx, config.Shutdown.ReconnectAfter); err != nil {
+		logger.Error("failed to flush the stores", "err", err)
 	}
 
-	http.ListenAndServe(":"+port, handler)
+	logger.Info("shut down")
 }
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons messages of clients are rejected for
+const (
+	rejectInvalid     = "invalid"
+	rejectRateLimited = "rate_limited"
+	rejectImplausible = "implausible"
+	rejectRun         = "invalid_run"
+)
+
+// standingBuckets are the upper bounds in seconds of the histogram of standing updates.
+var standingBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// metricSet counts what the server has done since it started. It is served at /metrics.
+type metricSet struct {
+	lock sync.Mutex
+
+	// received and sent are the messages by kind.
+	received, sent           map[string]uint64
+	receivedBytes, sentBytes uint64
+	// rejected are the messages of clients ignored or answered with a close, by reason.
+	rejected map[string]uint64
+	// submissions are the records submitted to the persistent leaderboard by the source of the run.
+	submissions map[string]uint64
+	// queued is the number of broadcast messages waiting to be written to clients.
+	queued int64
+
+	// standingUpdates counts the standing updates below each of standingBuckets.
+	standingUpdates     []uint64
+	standingUpdateCount uint64
+	standingUpdateSum   time.Duration
+}
+
+var metrics = newMetricSet()
+
+func newMetricSet() *metricSet {
+	return &metricSet{
+		received:        make(map[string]uint64),
+		sent:            make(map[string]uint64),
+		rejected:        make(map[string]uint64),
+		submissions:     make(map[string]uint64),
+		standingUpdates: make([]uint64, len(standingBuckets)),
+	}
+}
+
+func (m *metricSet) receive(kind string, size int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.received[kind]++
+	m.receivedBytes += uint64(size)
+}
+
+func (m *metricSet) send(kind string, size int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.sent[kind]++
+	m.sentBytes += uint64(size)
+}
+
+func (m *metricSet) reject(reason string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.rejected[reason]++
+}
+
+func (m *metricSet) submit(source string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.submissions[source]++
+}
+
+// queue adds n to the broadcast messages waiting to be written.
+func (m *metricSet) queue(n int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.queued += n
+}
+
+func (m *metricSet) updateStanding(d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, le := range standingBuckets {
+		if d.Seconds() <= le {
+			m.standingUpdates[i]++
+		}
+	}
+	m.standingUpdateCount++
+	m.standingUpdateSum += d
+}
+
+// metricWriter writes metrics in the Prometheus text format.
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (w *metricWriter) header(name, typ, help string) {
+	fmt.Fprintf(w.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a value of name with labels given as pairs of names and values.
+func (w *metricWriter) sample(name string, value interface{}, labels ...string) {
+	w.w.WriteString(name)
+	if len(labels) != 0 {
+		w.w.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i != 0 {
+				w.w.WriteByte(',')
+			}
+			fmt.Fprintf(w.w, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		w.w.WriteByte('}')
+	}
+	fmt.Fprintf(w.w, " %v\n", value)
+}
+
+func (w *metricWriter) gauge(name, help string, value interface{}) {
+	w.header(name, "gauge", help)
+	w.sample(name, value)
+}
+
+func (w *metricWriter) counter(name, help string, value interface{}) {
+	w.header(name, "counter", help)
+	w.sample(name, value)
+}
+
+// counters writes a counter with a label whose values are the keys of values.
+func (w *metricWriter) counters(name, help, label string, values map[string]uint64) {
+	w.header(name, "counter", help)
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		w.sample(name, values[k], label, k)
+	}
+}
+
+func (m *metricSet) write(w *metricWriter) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	w.counters("flappygopher_messages_received_total", "Messages received from clients by kind.", "kind", m.received)
+	w.counters("flappygopher_messages_sent_total", "Messages sent to clients by kind.", "kind", m.sent)
+	w.counter("flappygopher_received_bytes_total", "Bytes of the messages received from clients.", m.receivedBytes)
+	w.counter("flappygopher_sent_bytes_total", "Bytes of the messages sent to clients.", m.sentBytes)
+	w.counters("flappygopher_rejected_messages_total", "Messages of clients rejected by reason.", "reason", m.rejected)
+	w.counters("flappygopher_leaderboard_submissions_total", "Records submitted to the persistent leaderboard by the source of the run.", "source", m.submissions)
+	w.gauge("flappygopher_broadcast_queue_depth", "Messages of rooms waiting to be written to clients.", m.queued)
+
+	name := "flappygopher_standing_update_seconds"
+	w.header(name, "histogram", "Time taken to update the standing of a room after a submission.")
+	for i, le := range standingBuckets {
+		w.sample(name+"_bucket", m.standingUpdates[i], "le", fmt.Sprint(le))
+	}
+	w.sample(name+"_bucket", m.standingUpdateCount, "le", "+Inf")
+	w.sample(name+"_sum", m.standingUpdateSum.Seconds())
+	w.sample(name+"_count", m.standingUpdateCount)
+}
+
+// MetricsHandler serves the metrics of the server in the Prometheus text format.
+func (h *Hub) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	h.roomsLock.Lock()
+	rooms := len(h.rooms)
+	h.roomsLock.Unlock()
+
+	h.sessionsLock.Lock()
+	connections, sessions, bans := h.connections, len(h.sessions), len(h.bans)
+	h.sessionsLock.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	mw := &metricWriter{w: bufio.NewWriter(w)}
+	mw.gauge("flappygopher_connections", "Open WebSocket connections.", connections)
+	mw.gauge("flappygopher_sessions", "Clients that have been welcomed.", sessions)
+	mw.gauge("flappygopher_rooms", "Open rooms.", rooms)
+	mw.gauge("flappygopher_bans", "Banned player IDs and addresses.", bans)
+
+	origins := h.originStats()
+	name := "flappygopher_origin_connections"
+	mw.header(name, "gauge", "Open WebSocket connections by origin.")
+	for _, o := range origins {
+		mw.sample(name, o.Active, "origin", o.Origin)
+	}
+	name = "flappygopher_origin_connections_total"
+	mw.header(name, "counter", "WebSocket connections accepted by origin.")
+	for _, o := range origins {
+		mw.sample(name, o.Total, "origin", o.Origin)
+	}
+	name = "flappygopher_origin_forbidden_total"
+	mw.header(name, "counter", "WebSocket connections refused by origin.")
+	for _, o := range origins {
+		mw.sample(name, o.Forbidden, "origin", o.Origin)
+	}
+
+	metrics.write(mw)
+	mw.w.Flush()
+}
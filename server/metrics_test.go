@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"nhooyr.io/websocket"
+)
+
+// scrape returns the samples served at /metrics of server by their names with labels.
+func scrape(t *testing.T, server *httptest.Server) map[string]float64 {
+	t.Helper()
+
+	res, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("metrics responded with %s", res.Status)
+	}
+
+	samples := make(map[string]float64)
+	sc := bufio.NewScanner(res.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("invalid sample %q: %v", line, err)
+		}
+		samples[line[:i]] = v
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return samples
+}
+
+func TestMetrics(t *testing.T) {
+	dir := t.TempDir()
+
+	config := DefaultConfig()
+	config.StaticDir = ""
+	config.Leaderboard.Path = filepath.Join(dir, "leaderboard.json")
+	config.ProfilesPath = filepath.Join(dir, "profiles.json")
+
+	hub, err := NewHub(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(hub.Handler())
+	defer server.Close()
+
+	before := scrape(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws", &websocket.DialOptions{
+		Subprotocols: []string{message.BinaryCodec.Subprotocol()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	var receivedBytes int
+	send := func(m *message.Message) {
+		t.Helper()
+
+		b, err := message.BinaryCodec.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.Write(ctx, websocket.MessageBinary, b); err != nil {
+			t.Fatal(err)
+		}
+		receivedBytes += len(b)
+	}
+	// receive reads messages until one of kind.
+	receive := func(kind string) {
+		t.Helper()
+
+		for {
+			_, b, err := conn.Read(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var m message.Message
+			if err := message.BinaryCodec.Unmarshal(b, &m); err != nil {
+				t.Fatal(err)
+			}
+			if m.Kind == kind {
+				return
+			}
+		}
+	}
+
+	send(&message.Message{
+		Kind:  message.KindHello,
+		Hello: &message.Hello{Version: message.ProtocolVersion, Name: "metrics"},
+	})
+	receive(message.KindWelcome)
+
+	send(&message.Message{Kind: message.KindStart, User: message.User{Running: true}})
+	send(&message.Message{Kind: message.KindInput, Input: &message.Input{Tick: 1, Jump: true}})
+	// An input without the input is invalid.
+	send(&message.Message{Kind: message.KindInput})
+	// The server answers in order, so the messages above have been handled once the rooms arrive.
+	send(&message.Message{Kind: message.KindRooms})
+	receive(message.KindRooms)
+
+	after := scrape(t, server)
+
+	for series, want := range map[string]float64{
+		`flappygopher_connections`:                               1,
+		`flappygopher_sessions`:                                  1,
+		`flappygopher_origin_connections{origin="none"}`:         1,
+		`flappygopher_origin_connections_total{origin="none"}`:   before[`flappygopher_origin_connections_total{origin="none"}`] + 1,
+		`flappygopher_messages_received_total{kind="hello"}`:     before[`flappygopher_messages_received_total{kind="hello"}`] + 1,
+		`flappygopher_messages_received_total{kind="start"}`:     before[`flappygopher_messages_received_total{kind="start"}`] + 1,
+		`flappygopher_messages_received_total{kind="input"}`:     before[`flappygopher_messages_received_total{kind="input"}`] + 1,
+		`flappygopher_messages_received_total{kind="invalid"}`:   before[`flappygopher_messages_received_total{kind="invalid"}`] + 1,
+		`flappygopher_messages_received_total{kind="rooms"}`:     before[`flappygopher_messages_received_total{kind="rooms"}`] + 1,
+		`flappygopher_rejected_messages_total{reason="invalid"}`: before[`flappygopher_rejected_messages_total{reason="invalid"}`] + 1,
+		`flappygopher_received_bytes_total`:                      before[`flappygopher_received_bytes_total`] + float64(receivedBytes),
+		`flappygopher_messages_sent_total{kind="welcome"}`:       before[`flappygopher_messages_sent_total{kind="welcome"}`] + 1,
+		`flappygopher_messages_sent_total{kind="rooms"}`:         before[`flappygopher_messages_sent_total{kind="rooms"}`] + 1,
+		`flappygopher_rooms`:                                     1,
+	} {
+		if got := after[series]; got != want {
+			t.Errorf("%s = %v, want %v", series, got, want)
+		}
+	}
+
+	if after[`flappygopher_sent_bytes_total`] <= before[`flappygopher_sent_bytes_total`] {
+		t.Error("flappygopher_sent_bytes_total did not grow")
+	}
+
+	conn.Close(websocket.StatusNormalClosure, "")
+
+	// The server notices the close in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for scrape(t, server)[`flappygopher_connections`] != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the connection is still counted after it was closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := hub.Shutdown(ctx, 0); err != nil {
+		t.Error(err)
+	}
+}
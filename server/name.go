@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// maxNameLength is the length of the longest name in bytes before it is made unique in a room.
+	maxNameLength = 24
+	// maxRoomNameLength is the length of the longest room name in bytes.
+	maxRoomNameLength = 32
+	// defaultName is given to players whose names are empty or blocked.
+	defaultName = "Gopher"
+)
+
+// NameFilter makes the names clients send fit for the screens of the other players.
+type NameFilter struct {
+	// blocked are the words no name may contain, in lower case.
+	blocked []string
+}
+
+// LoadNameFilter reads the blocklist in path, a word on each line. Lines starting with # are ignored.
+// The filter blocks nothing if path is empty.
+func LoadNameFilter(path string) (*NameFilter, error) {
+	f := &NameFilter{}
+	if path == "" {
+		return f, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open name blocklist: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+
+		f.blocked = append(f.blocked, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read name blocklist: %w", err)
+	}
+
+	return f, nil
+}
+
+// Clean keeps the ASCII letters, digits and single spaces of name up to maxNameLength.
+// Names left empty or containing a blocked word are replaced with defaultName.
+func (f *NameFilter) Clean(name string) string {
+	if cleaned := f.clean(name, maxNameLength); cleaned != "" {
+		return cleaned
+	}
+
+	return defaultName
+}
+
+// CleanRoomName cleans the name of a room like Clean up to maxRoomNameLength.
+// Names containing a blocked word are dropped, since rooms need no name.
+func (f *NameFilter) CleanRoomName(name string) string {
+	return f.clean(name, maxRoomNameLength)
+}
+
+// clean keeps the ASCII letters, digits and single spaces of name up to maxLength.
+// It returns an empty string if name contains a blocked word.
+func (f *NameFilter) clean(name string, maxLength int) string {
+	var b strings.Builder
+	space := false
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			if space && b.Len() != 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(c)
+		case c == ' ':
+			space = true
+		}
+
+		if b.Len() >= maxLength {
+			break
+		}
+	}
+
+	cleaned := b.String()
+	if len(cleaned) > maxLength {
+		cleaned = strings.TrimSpace(cleaned[:maxLength])
+	}
+	if f.blocks(cleaned) {
+		return ""
+	}
+
+	return cleaned
+}
+
+// blocks reports whether name contains a blocked word. Spaces cannot be used to split a word.
+func (f *NameFilter) blocks(name string) bool {
+	folded := strings.ToLower(strings.ReplaceAll(name, " ", ""))
+	for _, word := range f.blocked {
+		if strings.Contains(folded, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// claimName reserves name in r, or name with the smallest number that makes it unique there.
+// Names differing only in case are the same.
+func (h *Hub) claimName(r *Room, name string) string {
+	h.roomsLock.Lock()
+	defer h.roomsLock.Unlock()
+
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := r.names[strings.ToLower(unique)]; !ok {
+			break
+		}
+
+		unique = fmt.Sprintf("%s %d", name, i)
+	}
+	r.names[strings.ToLower(unique)] = struct{}{}
+
+	return unique
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestNameFilterClean(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := ioutil.WriteFile(path, []byte("# comment\n\n  Badword \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := LoadNameFilter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{name: "Gordon", want: "Gordon"},
+		{name: "  Go   pher 2 ", want: "Go pher 2"},
+		{name: "<b>Go</b>\n", want: "bGob"},
+		{name: "ゴーファー", want: defaultName},
+		{name: "", want: defaultName},
+		{name: "abcdefghijklmnopqrstuvwxyz", want: "abcdefghijklmnopqrstuvwx"},
+		{name: "abcdefghijklmnopqrstuvw yz", want: "abcdefghijklmnopqrstuvw"},
+		{name: "my BADWORD", want: defaultName},
+		{name: "bad word", want: defaultName},
+	} {
+		if got := f.Clean(tc.name); got != tc.want {
+			t.Errorf("Clean(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{name: "Friday  race", want: "Friday race"},
+		{name: "ゴーファーの部屋", want: ""},
+		{name: "0123456789abcdefghijklmnopqrstuvwxyz", want: "0123456789abcdefghijklmnopqrstuv"},
+		{name: "badword room", want: ""},
+	} {
+		if got := f.CleanRoomName(tc.name); got != tc.want {
+			t.Errorf("CleanRoomName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLoadNameFilterWithoutPath(t *testing.T) {
+	f, err := LoadNameFilter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Clean("badword"); got != "badword" {
+		t.Errorf("Clean without a blocklist = %q", got)
+	}
+}
+
+func TestClaimName(t *testing.T) {
+	h := &Hub{}
+	r := &Room{names: make(map[string]struct{})}
+
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{name: "Gopher", want: "Gopher"},
+		{name: "gopher", want: "gopher 2"},
+		{name: "Gopher", want: "Gopher 3"},
+		{name: "Gopher 2", want: "Gopher 2 2"},
+		{name: "Other", want: "Other"},
+	} {
+		if got := h.claimName(r, tc.name); got != tc.want {
+			t.Errorf("claimName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxTrackedOrigins bounds the origins counted separately, since clients choose the header.
+	maxTrackedOrigins = 256
+	// noOrigin counts the connections without an Origin header, like the ones of the desktop build.
+	noOrigin = "none"
+	// otherOrigins counts the connections from origins beyond maxTrackedOrigins.
+	otherOrigins = "other"
+)
+
+// OriginStats are the WebSocket connections from an origin in /api/origins.
+type OriginStats struct {
+	Origin string
+	Active int
+	Total  int
+	// Forbidden is the number of connections refused because the origin is not allowed.
+	Forbidden int
+}
+
+// allowsOrigin reports whether the page that sent r may use the server.
+// Requests without an Origin and the ones from pages served by the server itself are always allowed.
+// The host of any other origin has to match one of AllowedOrigins as in websocket.AcceptOptions.OriginPatterns.
+func (c *Config) allowsOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, pattern := range c.AllowedOrigins {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(u.Host)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// countOrigin records a connection from origin that was accepted or forbidden.
+func (h *Hub) countOrigin(origin string, accepted bool) {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	if origin == "" {
+		origin = noOrigin
+	}
+
+	stats, ok := h.origins[origin]
+	if !ok {
+		if len(h.origins) >= maxTrackedOrigins {
+			origin = otherOrigins
+		}
+		if stats, ok = h.origins[origin]; !ok {
+			stats = &OriginStats{Origin: origin}
+			h.origins[origin] = stats
+		}
+	}
+
+	if !accepted {
+		stats.Forbidden++
+
+		return
+	}
+	stats.Active++
+	stats.Total++
+}
+
+// uncountOrigin records that an accepted connection from origin was closed.
+func (h *Hub) uncountOrigin(origin string) {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	if origin == "" {
+		origin = noOrigin
+	}
+	stats, ok := h.origins[origin]
+	if !ok {
+		stats = h.origins[otherOrigins]
+	}
+	stats.Active--
+}
+
+func (h *Hub) originStats() []OriginStats {
+	h.sessionsLock.Lock()
+	stats := make([]OriginStats, 0, len(h.origins))
+	for _, s := range h.origins {
+		stats = append(stats, *s)
+	}
+	h.sessionsLock.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Origin < stats[j].Origin
+	})
+
+	return stats
+}
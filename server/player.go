@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/sim"
+)
+
+// tickSlack is the number of ticks an input may be ahead of the wall clock.
+const tickSlack = sim.TPS
+
+// player is the server-side simulation of a connected gopher.
+// Its state is derived from jump inputs only.
+type player struct {
+	id, name string
+
+	seed      int64
+	world     *sim.World
+	startedAt time.Time
+	// jumps are the ticks the server applied the jumps of the current run at.
+	jumps []int
+	// submitted is set when the current run has been submitted.
+	submitted bool
+	// claimed is the last plausible state the client claimed in the current run.
+	claimed message.User
+}
+
+func newPlayer(id, name string, seed int64) *player {
+	p := &player{
+		id:    id,
+		name:  name,
+		seed:  seed,
+		world: sim.NewWorld(sim.NewCourse(seed)),
+	}
+	p.world.Body.Running = false
+
+	return p
+}
+
+func (p *player) start(now time.Time) {
+	p.world.Reset()
+	p.startedAt = now
+	p.jumps = nil
+	p.submitted = false
+	p.claimed = p.user()
+}
+
+// claim checks the state the client claims for its gopher against the last one in the run.
+// The state of an input is the one after the tick of in, and the state of a start, given a nil in,
+// is the one at the start of the run. Claims before the first run are not checked.
+func (p *player) claim(u message.User, in *message.Input) []violation {
+	if !p.played() {
+		return nil
+	}
+
+	tick := 0
+	if in != nil {
+		tick = in.Tick + 1
+	}
+	if u.Tick != tick {
+		return []violation{violationTick}
+	}
+	if in != nil && u.Tick <= p.claimed.Tick {
+		return []violation{violationRewind}
+	}
+
+	vs := checkClaim(p.claimed, u)
+	if len(vs) == 0 {
+		p.claimed = u
+	}
+
+	return vs
+}
+
+// apply advances the simulation to the tick of the input and applies it.
+// It returns false if the input is out of order or ahead of the wall clock.
+func (p *player) apply(in message.Input, now time.Time) bool {
+	body := &p.world.Body
+
+	if !body.Running {
+		return false
+	}
+	if in.Tick < body.Tick {
+		return false
+	}
+	if in.Tick > int(now.Sub(p.startedAt)*sim.TPS/time.Second)+tickSlack {
+		return false
+	}
+
+	if !p.world.AdvanceTo(in.Tick) {
+		if in.Jump {
+			p.jumps = append(p.jumps, in.Tick)
+		}
+		p.world.Step(sim.Input{Jump: in.Jump})
+	}
+
+	return true
+}
+
+// played reports whether the player has started a run in the room.
+func (p *player) played() bool {
+	return !p.startedAt.IsZero()
+}
+
+// finished reports whether the player has finished a run that has not been submitted.
+func (p *player) finished() bool {
+	return !p.startedAt.IsZero() && !p.world.Body.Running && !p.submitted
+}
+
+// submit verifies that run is the finished run of the player on the course the server issued,
+// made of the jumps the server applied and scoring what the server simulated.
+func (p *player) submit(run *message.Run) error {
+	if !p.finished() {
+		return errors.New("no finished run to submit")
+	}
+	if run.Seed != p.seed {
+		return errors.New("run is not on the course of the room")
+	}
+	if score := p.world.Body.Score(); run.Score != score {
+		return fmt.Errorf("run scored %d but the server simulated %d", run.Score, score)
+	}
+	if !equalJumps(run.Jumps, p.jumps) {
+		return errors.New("run jumps differ from the inputs the server applied")
+	}
+	if err := verifyRun(run); err != nil {
+		return err
+	}
+	p.submitted = true
+
+	return nil
+}
+
+func equalJumps(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *player) user() message.User {
+	body := &p.world.Body
+
+	return message.User{
+		ID:      p.id,
+		Name:    p.name,
+		X16:     body.X16,
+		Y16:     body.Y16,
+		VY16:    body.VY16,
+		Running: body.Running,
+		Score:   body.Score(),
+		Tick:    body.Tick,
+	}
+}
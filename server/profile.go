@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
+)
+
+const (
+	// profileRetention is how long the profile of a player who does not come back is kept.
+	profileRetention = 90 * 24 * time.Hour
+	// profileSaveDelay is how long visits are collected before the profiles are saved.
+	profileSaveDelay = 10 * time.Second
+)
+
+// Profile is what the server knows about the identity of a player.
+type Profile struct {
+	ID string
+	// Name is the name the player used last.
+	Name string
+	// Runs is the number of verified runs, and Best the best score of them.
+	Runs      int
+	Best      int
+	BestAt    time.Time
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// ProfileStore keeps the profiles of players.
+// Implementations must be safe for concurrent use.
+type ProfileStore interface {
+	// Seen records a visit of the player, creating its profile on the first one.
+	Seen(id, name string, at time.Time) error
+	// AddRun counts a verified run of the player.
+	AddRun(id string, score int, at time.Time) error
+	// Get returns the profile of the player and false if there is none.
+	Get(id string) (Profile, bool, error)
+	Close() error
+}
+
+// profiles maps player IDs to their profiles. It is not safe for concurrent use.
+type profiles map[string]*Profile
+
+func (p profiles) seen(id, name string, at time.Time) {
+	profile, ok := p[id]
+	if !ok {
+		profile = &Profile{
+			ID:        id,
+			FirstSeen: at,
+		}
+		p[id] = profile
+	}
+
+	profile.Name = name
+	profile.LastSeen = at
+}
+
+// addRun reports whether the player has a profile to count the run in.
+func (p profiles) addRun(id string, score int, at time.Time) bool {
+	profile, ok := p[id]
+	if !ok {
+		return false
+	}
+
+	profile.Runs++
+	if profile.Runs == 1 || score > profile.Best {
+		profile.Best = score
+		profile.BestAt = at
+	}
+
+	return true
+}
+
+func (p profiles) get(id string) (Profile, bool) {
+	profile, ok := p[id]
+	if !ok {
+		return Profile{}, false
+	}
+
+	return *profile, true
+}
+
+func (p profiles) prune(now time.Time) {
+	for id, profile := range p {
+		if now.Sub(profile.LastSeen) > profileRetention {
+			delete(p, id)
+		}
+	}
+}
+
+// MemoryProfileStore keeps profiles in memory only.
+type MemoryProfileStore struct {
+	lock     sync.Mutex
+	profiles profiles
+}
+
+var _ ProfileStore = &MemoryProfileStore{}
+
+func NewMemoryProfileStore() *MemoryProfileStore {
+	return &MemoryProfileStore{
+		profiles: make(profiles),
+	}
+}
+
+func (s *MemoryProfileStore) Seen(id, name string, at time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.profiles.seen(id, name, at)
+	s.profiles.prune(at)
+
+	return nil
+}
+
+func (s *MemoryProfileStore) AddRun(id string, score int, at time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.profiles.addRun(id, score, at)
+
+	return nil
+}
+
+func (s *MemoryProfileStore) Get(id string) (Profile, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	profile, ok := s.profiles.get(id)
+
+	return profile, ok, nil
+}
+
+func (s *MemoryProfileStore) Close() error {
+	return nil
+}
+
+// FileProfileStore keeps profiles in a JSON file.
+// The file is replaced atomically every time a run is added, and profileSaveDelay after a visit.
+type FileProfileStore struct {
+	path string
+
+	lock     sync.Mutex
+	profiles profiles
+	// dirty reports whether visits have not been saved yet. saving is the timer that saves them.
+	dirty  bool
+	saving *time.Timer
+}
+
+var _ ProfileStore = &FileProfileStore{}
+
+// NewFileProfileStore loads the profiles in path. The file is created on the first visit.
+func NewFileProfileStore(path string) (*FileProfileStore, error) {
+	s := &FileProfileStore{
+		path:     path,
+		profiles: make(profiles),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+
+	var list []*Profile
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles: %w", err)
+	}
+	for _, profile := range list {
+		s.profiles[profile.ID] = profile
+	}
+	s.profiles.prune(time.Now())
+
+	return s, nil
+}
+
+func (s *FileProfileStore) Seen(id, name string, at time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.profiles.seen(id, name, at)
+	s.profiles.prune(at)
+
+	s.dirty = true
+	if s.saving == nil {
+		s.saving = time.AfterFunc(profileSaveDelay, s.flush)
+	}
+
+	return nil
+}
+
+// flush saves the visits collected since the last save.
+func (s *FileProfileStore) flush() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.saving = nil
+	if !s.dirty {
+		return
+	}
+
+	if err := s.save(); err != nil {
+		logger.Error("failed to save profiles", "err", err)
+	}
+}
+
+func (s *FileProfileStore) AddRun(id string, score int, at time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.profiles.addRun(id, score, at) {
+		return nil
+	}
+
+	return s.save()
+}
+
+func (s *FileProfileStore) Get(id string) (Profile, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	profile, ok := s.profiles.get(id)
+
+	return profile, ok, nil
+}
+
+func (s *FileProfileStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.saving != nil {
+		s.saving.Stop()
+		s.saving = nil
+	}
+
+	return s.save()
+}
+
+func (s *FileProfileStore) save() error {
+	list := make([]*Profile, 0, len(s.profiles))
+	for _, profile := range s.profiles {
+		list = append(list, profile)
+	}
+
+	b, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.path, b); err != nil {
+		return err
+	}
+	s.dirty = false
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"reflect"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/sim"
+	"github.com/grafov/bcast"
+)
+
+const (
+	dailyRoomCode     = "daily"
+	roomCodeLength    = 6
+	defaultMaxPlayers = 16
+	maxPlayersLimit   = 64
+	maxSpectators     = 64
+	standingLength    = 5
+)
+
+// Room is a group of players flying through the same course.
+// Each room has its own broadcast group and standing.
+type Room struct {
+	code, name string
+	public     bool
+	maxPlayers int
+
+	// seed is the course seed of the room. The daily room follows sim.DailySeed instead.
+	seed     int64
+	daily    bool
+	location *time.Location
+
+	// players, spectators and names are guarded by the lock of the Hub.
+	players    int
+	spectators int
+	// names are the names of the players in lower case.
+	names map[string]struct{}
+	// emptiedAt is when the last player or spectator left the room.
+	emptiedAt time.Time
+
+	// period is the leaderboard period of the standing of the room.
+	period string
+	// length is the number of results in the standing.
+	length int
+	store  LeaderboardStore
+	group  *bcast.Group
+	done   chan struct{}
+
+	log *logger.Logger
+	// updates logs the frequent updates of the players with sampling.
+	updates *logger.Logger
+}
+
+func newRoom(code, name string, public bool, maxPlayers int, seed int64, config *Config) *Room {
+	r := &Room{
+		code:       code,
+		name:       name,
+		public:     public,
+		maxPlayers: maxPlayers,
+		seed:       seed,
+		location:   time.UTC,
+		period:     message.PeriodAllTime,
+		length:     config.Leaderboard.StandingLength,
+		store:      NewMemoryLeaderboardStore(config.Leaderboard.StandingLength, 0, time.UTC),
+	}
+	r.start(config)
+
+	return r
+}
+
+// newDailyRoom opens the public room whose course and standing change every day in loc.
+func newDailyRoom(store LeaderboardStore, loc *time.Location, config *Config) *Room {
+	r := &Room{
+		code:       dailyRoomCode,
+		name:       "Daily",
+		public:     true,
+		maxPlayers: config.Rooms.MaxPlayers,
+		daily:      true,
+		location:   loc,
+		period:     message.PeriodDaily,
+		length:     config.Leaderboard.StandingLength,
+		store:      store,
+	}
+	r.start(config)
+
+	return r
+}
+
+func (r *Room) start(config *Config) {
+	r.log = logger.With("room", r.code)
+	r.updates = r.log.Sampled(config.Log.SampleUpdates)
+	r.names = make(map[string]struct{})
+	r.group = bcast.NewGroup()
+	r.done = make(chan struct{})
+
+	go r.group.Broadcast(0)
+	go r.standingWorker()
+}
+
+func (r *Room) Seed() int64 {
+	if r.daily {
+		return sim.DailySeed(time.Now().In(r.location))
+	}
+
+	return r.seed
+}
+
+func (r *Room) info(players int) message.Room {
+	return message.Room{
+		Code:       r.code,
+		Name:       r.name,
+		Public:     r.public,
+		Players:    players,
+		MaxPlayers: r.maxPlayers,
+		Seed:       r.Seed(),
+	}
+}
+
+func (r *Room) close() {
+	close(r.done)
+	r.group.Close()
+
+	if err := r.store.Close(); err != nil {
+		r.log.Error("failed to close leaderboard", "err", err)
+	}
+}
+
+// submit adds the record of a verified run to the leaderboard of the room. Runs without a score are dropped.
+func (r *Room) submit(user message.User, run *message.Run) error {
+	if run.Score == 0 {
+		return nil
+	}
+
+	record, err := newRecord(user.ID, user.Name, run)
+	if err != nil {
+		return err
+	}
+	if err := r.store.Submit(record); err != nil {
+		return err
+	}
+	if r.daily {
+		metrics.submit("room")
+	}
+
+	return nil
+}
+
+// standing returns the best results of the room in its current period.
+func (r *Room) standing() []message.Result {
+	standing, err := topResults(r.store, r.period, r.length, time.Now(), r.location)
+	if err != nil {
+		r.log.Error("failed to load leaderboard", "err", err)
+	}
+
+	return standing
+}
+
+func (r *Room) standingWorker() {
+	member := r.group.Join()
+	defer member.Close()
+
+	standing := r.standing()
+
+	for {
+		select {
+		case m, ok := <-member.Read:
+			if !ok {
+				return
+			}
+
+			msg := m.(*message.Message)
+			if msg.Kind == message.KindUpdate {
+				r.updates.Debug("broadcast", "kind", msg.Kind, "player", msg.User.ID)
+			} else {
+				r.log.Debug("broadcast", "kind", msg.Kind, "player", msg.User.ID)
+			}
+
+			// Submissions have been stored by the sessions of the players.
+			if msg.Kind == message.KindSubmit {
+				if msg.Run.Score == 0 {
+					continue
+				}
+
+				start := time.Now()
+				tmp := r.standing()
+				metrics.updateStanding(time.Since(start))
+
+				if !reflect.DeepEqual(standing, tmp) {
+					standing = tmp
+
+					member.Send(&message.Message{
+						Kind:     message.KindStanding,
+						Standing: tmp,
+					})
+				}
+			} else if msg.Kind == message.KindJoin {
+				member.Send(&message.Message{
+					Kind:     message.KindStanding,
+					Standing: r.standing(),
+				})
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+const roomCodeChars = "abcdefghjkmnpqrstuvwxyz23456789"
+
+func randomCode(length int) (string, error) {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	for i := range b {
+		b[i] = roomCodeChars[int(b[i])%len(roomCodeChars)]
+	}
+
+	return string(b), nil
+}
+
+func randomSeed() (int64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+
+	return int64(binary.BigEndian.Uint64(b[:]) >> 1), nil
+}
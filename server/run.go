@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/sim"
+)
+
+const (
+	// maxRunJumps bounds the cost of replaying a submitted run.
+	maxRunJumps = 1 << 16
+	// clockSkew is how far in the future a run submitted by a client may end.
+	clockSkew = time.Minute
+)
+
+// verifyOfflineRun checks a run played on the daily course while the client was offline.
+// The client picks the daily course in its own time zone, so the days next to the day
+// of the run in loc are accepted as well. Runs older than retention are not kept for any board.
+func verifyOfflineRun(run *message.Run, now time.Time, loc *time.Location, retention time.Duration) error {
+	if run.At.After(now.Add(clockSkew)) {
+		return errors.New("run ends in the future")
+	}
+	if now.Sub(run.At) >= retention {
+		return errors.New("run is too old")
+	}
+
+	at := run.At.In(loc)
+	if run.Seed != sim.DailySeed(at) &&
+		run.Seed != sim.DailySeed(at.AddDate(0, 0, -1)) &&
+		run.Seed != sim.DailySeed(at.AddDate(0, 0, 1)) {
+		return errors.New("run is not on a daily course of its day")
+	}
+
+	return verifyRun(run)
+}
+
+// verifyRun replays run and checks that it reproduces the score.
+func verifyRun(run *message.Run) error {
+	if len(run.Jumps) > maxRunJumps {
+		return fmt.Errorf("run has too many jumps: %d", len(run.Jumps))
+	}
+	for i, tick := range run.Jumps {
+		if tick < 0 || (i > 0 && tick <= run.Jumps[i-1]) {
+			return errors.New("jumps are not in ascending order")
+		}
+	}
+
+	w := sim.NewWorld(sim.NewCourse(run.Seed))
+	w.Replay(run.Jumps)
+
+	if score := w.Body.Score(); score != run.Score {
+		return fmt.Errorf("replay scored %d instead of %d", score, run.Score)
+	}
+
+	return nil
+}
+
+var errDuplicateRun = errors.New("run has been submitted before")
+
+// runHash identifies a run by its course and its jumps.
+func runHash(run *message.Run) string {
+	b := make([]byte, binary.MaxVarintLen64*(len(run.Jumps)+1))
+	n := binary.PutVarint(b, run.Seed)
+	for _, tick := range run.Jumps {
+		n += binary.PutVarint(b[n:], int64(tick))
+	}
+	sum := sha256.Sum256(b[:n])
+
+	return hex.EncodeToString(sum[:16])
+}
+
+// claimRun remembers the run of the player and reports false if it has been submitted before.
+// Runs are remembered until they are too old to be submitted.
+func (h *Hub) claimRun(playerID string, run *message.Run) bool {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	now := time.Now()
+	for key, at := range h.runs {
+		if now.Sub(at) >= h.config.Leaderboard.Retention {
+			delete(h.runs, key)
+		}
+	}
+
+	key := playerID + "/" + runHash(run)
+	if _, ok := h.runs[key]; ok {
+		return false
+	}
+	h.runs[key] = run.At
+
+	return true
+}
+
+// submitOfflineRun adds a run played offline by the player with the ID and the name
+// to its profile and the persistent leaderboard. Each run is only added once.
+func (h *Hub) submitOfflineRun(playerID, name string, run *message.Run) error {
+	if err := verifyOfflineRun(run, time.Now(), h.location, h.config.Leaderboard.Retention); err != nil {
+		return err
+	}
+	if !h.claimRun(playerID, run) {
+		return errDuplicateRun
+	}
+
+	// The leaderboard also knows the runs submitted before the server restarted.
+	if run.Score > 0 {
+		record, err := newRecord(playerID, name, run)
+		if err != nil {
+			return err
+		}
+
+		if err := h.store.Submit(record); err != nil {
+			return err
+		}
+		metrics.submit("offline")
+	}
+
+	if err := h.profiles.AddRun(playerID, run.Score, run.At); err != nil {
+		logger.Error("failed to update profile", "player", playerID, "err", err)
+	}
+
+	return nil
+}
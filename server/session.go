@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/logger"
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"github.com/grafov/bcast"
+	"nhooyr.io/websocket"
+)
+
+// forwardQueueLength is the number of messages of a room that can wait to be written to a client.
+const forwardQueueLength = 64
+
+// session is the connection of a player, who can move between rooms.
+type session struct {
+	hub    *Hub
+	conn   *websocket.Conn
+	codec  message.Codec
+	cancel context.CancelFunc
+	// done is closed after the session has left.
+	done chan struct{}
+	id   string
+	// name is the cleaned name of the player, which is made unique in each room it joins.
+	name string
+	// addr is the remote address of the connection without the port.
+	addr string
+	// spectator watches rooms without playing.
+	spectator bool
+
+	room   *Room
+	member *bcast.Member
+	player *player
+
+	// log adds the address, the player and the room of the session to the logs.
+	log *logger.Logger
+	// updates logs the frequent messages of the player with sampling.
+	updates *logger.Logger
+
+	// status is a snapshot of the player for the API.
+	status OnlinePlayer
+	// listed is set while the player is in a public room. Players in private rooms are not listed,
+	// since the code of a room is all it takes to join it.
+	listed bool
+	// playing is set from the start of a run until it is submitted.
+	playing    bool
+	statusLock sync.Mutex
+}
+
+// setLogger adds the fields of the session known so far to its logs.
+func (s *session) setLogger() {
+	kv := []interface{}{"addr", s.addr}
+	if s.id != "" {
+		kv = append(kv, "player", s.id)
+	}
+	if s.room != nil {
+		kv = append(kv, "room", s.room.code)
+	}
+
+	s.log = logger.With(kv...)
+	s.updates = s.log.Sampled(s.hub.config.Log.SampleUpdates)
+}
+
+// Status returns the snapshot of the player and whether it may be listed by the API.
+func (s *session) Status() (OnlinePlayer, bool) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	return s.status, s.listed
+}
+
+func (s *session) setStatus(user message.User) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	s.status.Name = user.Name
+	s.status.Running = user.Running
+	s.status.Score = user.Score
+}
+
+func (s *session) setRoom(code string, public bool) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	s.status = OnlinePlayer{
+		Room: code,
+	}
+	s.listed = public
+	s.playing = false
+}
+
+// Playing reports whether the player is in the middle of a run.
+func (s *session) Playing() bool {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	return s.playing
+}
+
+func (s *session) setPlaying(playing bool) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	s.playing = playing
+}
+
+func (s *session) read(ctx context.Context, msg *message.Message) error {
+	_, b, err := s.conn.Read(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := s.codec.Unmarshal(b, msg); err != nil {
+		return err
+	}
+
+	// Kinds are only counted once they are known to be valid.
+	kind := msg.Kind
+	if !msg.Validate() {
+		kind = rejectInvalid
+	}
+	metrics.receive(kind, len(b))
+
+	return nil
+}
+
+func (s *session) write(ctx context.Context, msg *message.Message) error {
+	b, err := s.codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	typ := websocket.MessageText
+	if s.codec.Binary() {
+		typ = websocket.MessageBinary
+	}
+
+	if err := s.conn.Write(ctx, typ, b); err != nil {
+		return err
+	}
+	metrics.send(msg.Kind, len(b))
+
+	return nil
+}
+
+// join moves the session into r, which the player has already entered in the Hub.
+// The client is told the name of the player in r. Spectators have no name.
+func (s *session) join(ctx context.Context, r *Room, info message.Room) error {
+	s.leave()
+
+	var name string
+	if !s.spectator {
+		name = s.hub.claimName(r, s.name)
+	}
+
+	err := s.write(ctx, &message.Message{
+		Kind: message.KindJoin,
+		User: message.User{
+			ID:   s.id,
+			Name: name,
+		},
+		Room: &info,
+	})
+	if err != nil {
+		s.hub.leave(r, s.spectator, name)
+
+		return err
+	}
+
+	s.enter(ctx, r, info, name)
+
+	return nil
+}
+
+// enter starts receiving the messages of r as name after the client has been told about it.
+func (s *session) enter(ctx context.Context, r *Room, info message.Room, name string) {
+	s.room = r
+	s.player = newPlayer(s.id, name, info.Seed)
+	s.setRoom(r.code, r.public)
+	s.setLogger()
+
+	s.member = r.group.Join()
+	go s.forward(ctx, s.member)
+
+	s.member.Send(&message.Message{
+		Kind: message.KindJoin,
+	})
+}
+
+// keepAlive pings the client every interval and closes the connection as idle if a ping is not answered.
+// It is for spectators, who only listen and would be idle by the messages they send.
+func (s *session) keepAlive(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, pongTimeout)
+		err := s.conn.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				s.log.Info("closed a connection that did not answer a ping", "err", err)
+				s.conn.Close(websocket.StatusCode(message.CloseIdle), "did not answer a ping")
+			}
+
+			return
+		}
+	}
+}
+
+// forward writes the messages of the room to the client.
+// The messages are queued in between so that the depth of the queue can be measured.
+// It keeps draining the member after a write error so that the member can be closed.
+func (s *session) forward(ctx context.Context, member *bcast.Member) {
+	queue := make(chan *message.Message, forwardQueueLength)
+	go func() {
+		defer close(queue)
+
+		for msg := range member.Read {
+			m := msg.(*message.Message)
+
+			// Joins and submissions are only for the standing of the room.
+			if m.Kind == message.KindJoin || m.Kind == message.KindSubmit {
+				continue
+			}
+
+			metrics.queue(1)
+			queue <- m
+		}
+	}()
+
+	failed := false
+	for m := range queue {
+		metrics.queue(-1)
+		if failed {
+			continue
+		}
+
+		if err := s.write(ctx, m); err != nil {
+			failed = true
+			s.cancel()
+		}
+	}
+}
+
+func (s *session) leave() {
+	if s.room == nil {
+		return
+	}
+
+	s.member.Send(&message.Message{
+		Kind: message.KindLeave,
+		User: message.User{
+			ID: s.id,
+		},
+	})
+	s.member.Close()
+	s.hub.leave(s.room, s.spectator, s.player.name)
+
+	s.room = nil
+	s.member = nil
+	s.player = nil
+	s.setRoom("", false)
+	s.setLogger()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cs3238-tsuzu/flappygopher-online/internal/message"
+	"nhooyr.io/websocket"
+)
+
+const (
+	// shutdownDrain is how long the runs in progress may go on after the server is told to stop.
+	shutdownDrain = 30 * time.Second
+	// shutdownReconnectAfter is how long clients are asked to wait before they come back.
+	shutdownReconnectAfter = 5 * time.Second
+	// shutdownNoticeTimeout is how long writing the shutdown notice to a client may take.
+	shutdownNoticeTimeout = time.Second
+	drainPollInterval     = 100 * time.Millisecond
+)
+
+// register adds a welcomed session and reports false if the hub is shutting down.
+func (h *Hub) register(s *session) bool {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	if h.shuttingDown {
+		return false
+	}
+	h.sessions[s] = struct{}{}
+
+	return true
+}
+
+func (h *Hub) unregister(s *session) {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	delete(h.sessions, s)
+}
+
+// closing reports whether the hub is shutting down.
+func (h *Hub) closing() bool {
+	h.sessionsLock.Lock()
+	defer h.sessionsLock.Unlock()
+
+	return h.shuttingDown
+}
+
+// Shutdown tells every client that the server is going away and asks it to reconnect after reconnectAfter.
+// The connections of the players in the middle of a run are closed once the runs have been submitted
+// or ctx is done, and the others at once. The stores are flushed after every connection has been closed.
+func (h *Hub) Shutdown(ctx context.Context, reconnectAfter time.Duration) error {
+	h.sessionsLock.Lock()
+	h.shuttingDown = true
+	sessions := make([]*session, 0, len(h.sessions))
+	for s := range h.sessions {
+		sessions = append(sessions, s)
+	}
+	h.sessionsLock.Unlock()
+
+	notice := &message.Message{
+		Kind: message.KindShutdown,
+		Shutdown: &message.Shutdown{
+			ReconnectAfter: reconnectAfter,
+		},
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range sessions {
+		wg.Add(1)
+		go func(s *session) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownNoticeTimeout)
+			defer cancel()
+
+			s.write(ctx, notice)
+		}(s)
+	}
+	wg.Wait()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	closed := make(map[*session]bool)
+	for {
+		h.sessionsLock.Lock()
+		remaining := make([]*session, 0, len(h.sessions))
+		for s := range h.sessions {
+			remaining = append(remaining, s)
+		}
+		h.sessionsLock.Unlock()
+
+		if len(remaining) == 0 {
+			break
+		}
+
+		for _, s := range remaining {
+			if closed[s] || (ctx.Err() == nil && s.Playing()) {
+				continue
+			}
+			closed[s] = true
+
+			// Closing waits for the client to answer.
+			go s.conn.Close(websocket.StatusServiceRestart, "server is shutting down")
+		}
+
+		<-ticker.C
+	}
+
+	err := h.store.Close()
+	if perr := h.profiles.Close(); err == nil {
+		err = perr
+	}
+
+	return err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	// spectateRetryInterval is the number of ticks between the attempts of a spectator to connect.
+	spectateRetryInterval = 5 * 60
+	// freeCameraSpeed is how many pixels the free camera moves in a tick.
+	freeCameraSpeed = 8
+)
+
+// updateSpectate moves the camera of a spectator.
+// Jumping switches from following the leader to following each player, and then to the free camera,
+// which is moved by the arrow keys.
+func (g *Game) updateSpectate() {
+	if g.client.Status() == StatusOffline {
+		g.mode = ModeConnect
+		g.connect()
+
+		return
+	}
+
+	players := g.client.List()
+	if jump() {
+		g.nextTarget(players)
+	}
+
+	if g.freeCamera {
+		g.spectated = nil
+
+		if ebiten.IsKeyPressed(ebiten.KeyLeft) {
+			g.cameraX -= freeCameraSpeed
+		}
+		if ebiten.IsKeyPressed(ebiten.KeyRight) {
+			g.cameraX += freeCameraSpeed
+		}
+
+		return
+	}
+
+	g.spectated = g.target(players)
+	if g.spectated != nil {
+		x, _ := g.spectated.Pos()
+		g.cameraX = x/16 - 240
+	}
+}
+
+// target returns the player the camera follows. It is the leader if the followed player has left.
+func (g *Game) target(players []*Gopher) *Gopher {
+	for _, p := range players {
+		if g.followID != "" && p.id == g.followID {
+			return p
+		}
+	}
+	g.followID = ""
+
+	var leader *Gopher
+	var leaderX int
+	var leaderRunning bool
+	for _, p := range players {
+		x, _ := p.Pos()
+		running := p.Running()
+
+		if leader == nil || (running && !leaderRunning) || (running == leaderRunning && x > leaderX) {
+			leader, leaderX, leaderRunning = p, x, running
+		}
+	}
+
+	return leader
+}
+
+func (g *Game) nextTarget(players []*Gopher) {
+	switch {
+	case g.freeCamera:
+		g.freeCamera = false
+	case g.followID == "":
+		if len(players) == 0 {
+			g.freeCamera = true
+
+			return
+		}
+		g.followID = players[0].id
+	default:
+		for i, p := range players {
+			if p.id == g.followID && i+1 < len(players) {
+				g.followID = players[i+1].id
+
+				return
+			}
+		}
+		g.followID = ""
+		g.freeCamera = true
+	}
+}
+
+// spectateLabel describes what the camera of a spectator shows.
+func (g *Game) spectateLabel() string {
+	if _, ok := g.client.Room(); !ok {
+		return "NOT IN A ROOM: " + g.client.RoomError()
+	}
+
+	switch {
+	case g.freeCamera:
+		return "FREE CAMERA"
+	case g.spectated == nil:
+		return "WAITING FOR PLAYERS"
+	case g.followID == "":
+		return "LEADER: " + g.spectated.Name()
+	default:
+		return "FOLLOWING: " + g.spectated.Name()
+	}
+}
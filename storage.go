@@ -0,0 +1,48 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// storageDir is the directory the game keeps its data in.
+func storageDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "flappygopher-online"), nil
+}
+
+// loadStorage returns the data saved as key and nil if there is none.
+func loadStorage(key string) ([]byte, error) {
+	dir, err := storageDir()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return b, err
+}
+
+func saveStorage(key string, b []byte) error {
+	dir, err := storageDir()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, key), b, 0644)
+}
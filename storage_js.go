@@ -0,0 +1,48 @@
+//go:build js
+// +build js
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall/js"
+)
+
+var errNoStorage = errors.New("localStorage is not available")
+
+// withLocalStorage calls fn with localStorage.
+// Browsers throw when the storage is disabled or full, which is returned as an error.
+func withLocalStorage(fn func(storage js.Value)) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("localStorage failed: %v", r)
+		}
+	}()
+
+	storage := js.Global().Get("localStorage")
+	if storage.IsUndefined() || storage.IsNull() {
+		return errNoStorage
+	}
+	fn(storage)
+
+	return nil
+}
+
+// loadStorage returns the data saved as key and nil if there is none.
+func loadStorage(key string) ([]byte, error) {
+	var b []byte
+	err := withLocalStorage(func(storage js.Value) {
+		if v := storage.Call("getItem", key); !v.IsNull() {
+			b = []byte(v.String())
+		}
+	})
+
+	return b, err
+}
+
+func saveStorage(key string, b []byte) error {
+	return withLocalStorage(func(storage js.Value) {
+		storage.Call("setItem", key, string(b))
+	})
+}